@@ -0,0 +1,22 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Dense bitmap is allocated with an anonymous mmap instead of the Go heap:
+// the runtime can't recover from a failed 512 MB allocation, mmap just returns ENOMEM.
+// Bitmap has no pointers, so living outside the GC heap is fine. Memory is only returned by freeBitmap
+func allocateBitmap() (*Bitmap, error) {
+	mem, err := mmapRetry(-1, 0, int(unsafe.Sizeof(Bitmap{})), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	return (*Bitmap)(unsafe.Pointer(&mem[0])), nil
+}
+
+// Unmaps a bitmap of allocateBitmap, nothing may touch it afterwards
+func freeBitmap(bitmap *Bitmap) error {
+	return munmapRetry(unsafe.Slice((*byte)(unsafe.Pointer(bitmap)), unsafe.Sizeof(Bitmap{})))
+}
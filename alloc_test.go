@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+// Lines of every shape the hot loop sees: plain, padded, max length, malformed
+var allocSample = []byte("192.168.1.1\n10.0.0.1\r\n 8.8.8.8 \n255.255.255.255\n1.2.3\nnot an address\n")
+
+// Calls parse for every line of the sample
+func eachSampleLine(parse func(start, end int)) func() {
+	return func() {
+		start := 0
+		for i, c := range allocSample {
+			if c == '\n' {
+				parse(start, i)
+				start = i + 1
+			}
+		}
+	}
+}
+
+var sink uint32
+
+// A []byte copy of the line or an escaping buffer costs more than the parsing itself.
+// A new parser on the common path belongs here too
+func TestParseIPv4NoAllocs(t *testing.T) {
+	b := newTestBitmap(t)
+
+	tests := []struct {
+		name string
+		run  func()
+	}{
+		{"parseIPv4", eachSampleLine(func(start, end int) {
+			first, rest := parseIPv4(allocSample, start, end)
+			sink ^= uint32(first)<<24 | rest
+		})},
+		{"parseIPv4Strict", eachSampleLine(func(start, end int) {
+			ip, _ := parseIPv4Strict(allocSample, start, end)
+			sink ^= ip
+		})},
+		{"setBitLocal", func() {
+			setBitLocal(b, byte(sink>>24), sink&0xFFFFFF)
+			sink++
+		}},
+		{"Bitmap.AddNew", func() {
+			if b.AddNew(sink) {
+				sink++
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		if allocs := testing.AllocsPerRun(1000, test.run); allocs > 0 {
+			t.Errorf("%s: %g allocs per run, want 0", test.name, allocs)
+		}
+	}
+}
+
+func BenchmarkParseIPv4(b *testing.B) {
+	run := eachSampleLine(func(start, end int) {
+		first, rest := parseIPv4(allocSample, start, end)
+		sink ^= uint32(first)<<24 | rest
+	})
+	b.SetBytes(int64(len(allocSample)))
+	b.ReportAllocs()
+	for b.Loop() {
+		run()
+	}
+}
+
+func BenchmarkParseIPv4Strict(b *testing.B) {
+	run := eachSampleLine(func(start, end int) {
+		ip, _ := parseIPv4Strict(allocSample, start, end)
+		sink ^= ip
+	})
+	b.SetBytes(int64(len(allocSample)))
+	b.ReportAllocs()
+	for b.Loop() {
+		run()
+	}
+}
+
+func BenchmarkSetBitLocal(b *testing.B) {
+	bm, err := allocateBitmap()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ip := uint32(0)
+	b.ReportAllocs()
+	for b.Loop() {
+		setBitLocal(bm, byte(ip>>24), ip&0xFFFFFF)
+		ip += 0x9E3779B1 // scattered over the whole bitmap
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	BACKEND_DENSE  = "dense"
+	BACKEND_SPARSE = "sparse"
+	BACKEND_HLL    = "hll"
+)
+
+func validateBackend(backend string) error {
+	switch backend {
+	case BACKEND_DENSE, BACKEND_SPARSE, BACKEND_HLL:
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q, expected dense, sparse or hll", backend)
+}
+
+// Dense backend also becomes the global bitmap. If it can't be allocated,
+// we fall back to the sparse backend rather than crash
+func newCounter(backend string) Counter {
+	switch backend {
+	case BACKEND_HLL:
+		return NewHyperLogLog(HLL_PRECISION, config.Seed)
+	case BACKEND_SPARSE:
+		return NewSparseSet()
+	}
+
+	dense, err := allocateBitmap()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't allocate 512 MB bitmap (%v), falling back to the sparse backend\n", err)
+		config.Backend = BACKEND_SPARSE
+		return NewSparseSet()
+	}
+
+	bitmap = dense
+	return bitmap
+}
+
+// After a fallback to sparse the flags are checked again against the backend actually in use
+func checkFallback() error {
+	if config.Backend == BACKEND_DENSE {
+		return nil
+	}
+	if err := validateConfig(); err != nil {
+		return fmt.Errorf("no memory for the dense bitmap: %w", err)
+	}
+	return nil
+}
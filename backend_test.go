@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// Anonymous mmap failing like on a box without 512 MB to spare, files still map
+func constrainMemory(t *testing.T) {
+	t.Helper()
+	mmapSyscall = func(fd int, offset int64, length, prot, flags int) ([]byte, error) {
+		if fd == -1 {
+			return nil, syscall.ENOMEM
+		}
+		return syscall.Mmap(fd, offset, length, prot, flags)
+	}
+	t.Cleanup(func() { mmapSyscall = syscall.Mmap })
+}
+
+func TestDenseFallsBackToSparse(t *testing.T) {
+	resetConfig(t)
+	constrainMemory(t)
+
+	counter := newCounter(BACKEND_DENSE)
+	if _, ok := counter.(*SparseSet); !ok {
+		t.Fatalf("got %T, want *SparseSet", counter)
+	}
+	if config.Backend != BACKEND_SPARSE || bitmap != nil {
+		t.Fatalf("backend %q, bitmap %p after the fallback", config.Backend, bitmap)
+	}
+	if err := checkFallback(); err != nil {
+		t.Fatalf("plain counting must go on, got %v", err)
+	}
+
+	filename := writeInput(t, "s.txt", "1.1.1.1\n2.2.2.2\n1.1.1.1\n")
+	if count := countUniqueIPs([]string{filename}, counter); count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+}
+
+// Outputs read from the dense bitmap stop before anything is counted
+func TestFallbackRejectsDenseOnlyModes(t *testing.T) {
+	for _, setup := range []func(){
+		func() { config.List = true },
+		func() { config.Save = "out.bmp" },
+		func() { config.Pairs = true },
+	} {
+		resetConfig(t)
+		constrainMemory(t)
+		setup()
+
+		newCounter(BACKEND_DENSE)
+		if err := checkFallback(); err == nil {
+			t.Errorf("%+v: no error after the fallback", config)
+		}
+	}
+}
+
+// Loading saved bitmaps without memory for one is an error, not an out of memory crash
+func TestSavedBitmapsWithoutMemory(t *testing.T) {
+	resetConfig(t)
+	saved := newTestBitmap(t)
+	saved.Add(0x0A000001)
+	filename := filepath.Join(t.TempDir(), "saved.bin")
+	if err := SaveBitmapCompact(saved, filename); err != nil {
+		t.Fatal(err)
+	}
+	constrainMemory(t)
+
+	if _, err := LoadBitmap(filename); !errors.Is(err, syscall.ENOMEM) {
+		t.Errorf("LoadBitmap: got %v, want ENOMEM", err)
+	}
+	if err := mergeSavedBitmaps(saved, []string{filename}); !errors.Is(err, syscall.ENOMEM) {
+		t.Errorf("mergeSavedBitmaps: got %v, want ENOMEM", err)
+	}
+	if _, err := appendSaveBitmap(saved, filename); !errors.Is(err, syscall.ENOMEM) {
+		t.Errorf("appendSaveBitmap: got %v, want ENOMEM", err)
+	}
+	if verifySavedBitmaps(io.Discard, []string{filename}) {
+		t.Error("verifySavedBitmaps passed without a bitmap to load into")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Timings of -measure-runs full counts of the same input, after -warmup-runs ones
+type BenchmarkResult struct {
+	Warmup int             `json:"warmup"`
+	Runs   []time.Duration `json:"runs_ns"`
+	Min    time.Duration   `json:"min_ns"`
+	Median time.Duration   `json:"median_ns"`
+	Max    time.Duration   `json:"max_ns"`
+	Bytes  int64           `json:"bytes"`
+}
+
+// Warmup runs fault the file pages and the bitmap in, so measured runs see steady state.
+// The bitmap is Reset between runs instead of being allocated again
+func runBenchmark(filenames []string, bitmap *Bitmap, warmup, runs int) (uint64, *BenchmarkResult) {
+	result := &BenchmarkResult{Warmup: warmup}
+	for _, filename := range filenames {
+		if fileInfo, err := os.Stat(filename); err == nil {
+			result.Bytes += fileInfo.Size()
+		}
+	}
+
+	var count uint64
+	for i := 0; i < warmup+runs; i++ {
+		bitmap.Reset()
+		startTime := time.Now()
+		count = countUniqueIPs(filenames, bitmap)
+		if i >= warmup {
+			result.Runs = append(result.Runs, time.Since(startTime))
+		}
+	}
+
+	sorted := slices.Sorted(slices.Values(result.Runs))
+	result.Min, result.Median, result.Max = sorted[0], sorted[len(sorted)/2], sorted[len(sorted)-1]
+	return count, result
+}
+
+func (b *BenchmarkResult) throughput(d time.Duration) string {
+	return fmt.Sprintf("%.1f MB/s", float64(b.Bytes)/d.Seconds()/(1<<20))
+}
+
+func printBenchmark(w io.Writer, b *BenchmarkResult) {
+	fmt.Fprintf(w, "Benchmark: %d warmup runs, %d measured\n", b.Warmup, len(b.Runs))
+	for i, run := range b.Runs {
+		fmt.Fprintf(w, "  run %d\t%v\t%s\n", i+1, run, b.throughput(run))
+	}
+	fmt.Fprintf(w, "  min %v (%s), median %v (%s), max %v (%s)\n",
+		b.Min, b.throughput(b.Min), b.Median, b.throughput(b.Median), b.Max, b.throughput(b.Max))
+}
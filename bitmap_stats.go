@@ -0,0 +1,66 @@
+package main
+
+import "math/bits"
+
+// Snapshot of everything the diagnostics look at, from one pass over the bitmap
+type BitmapStats struct {
+	Unique         uint64
+	Min, Max       uint32 // only valid when Unique > 0
+	NonEmptyShards int    // /8 segments with at least one address
+	Distinct24     uint64 // /24 networks with at least one address
+	PerShard       [OCTET_MAX_VALUE]uint64
+}
+
+// Unique count, range, /8 histogram and /24 coverage in a single parallel pass over the segments,
+// instead of Count, Min, Max and the histogram walking 512 MB each.
+// Call it after all Adds are done: words are read without atomics
+func (b *Bitmap) Stats() BitmapStats {
+	type segmentStats struct {
+		count, distinct24 uint64
+		min, max          uint32
+	}
+	var segments [OCTET_MAX_VALUE]segmentStats
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for octet := t.start; octet < t.end; octet++ {
+			s := &segments[octet]
+			base := uint32(octet) << 24
+
+			// 4 words = 256 addresses = one /24
+			for wordIdx := 0; wordIdx < BITMAP_SEGMENT_SIZE; wordIdx += 4 {
+				words := b.segments[octet][wordIdx : wordIdx+4]
+				if words[0]|words[1]|words[2]|words[3] == 0 {
+					continue
+				}
+				s.distinct24++
+
+				for i, word := range words {
+					if word == 0 {
+						continue
+					}
+					if s.count == 0 {
+						s.min = base | uint32(wordIdx+i)<<6 | uint32(bits.TrailingZeros64(word))
+					}
+					s.max = base | uint32(wordIdx+i)<<6 | uint32(63-bits.LeadingZeros64(word))
+					s.count += uint64(bits.OnesCount64(word))
+				}
+			}
+		}
+	})
+
+	stats := BitmapStats{}
+	for octet, s := range segments {
+		stats.PerShard[octet] = s.count
+		if s.count == 0 {
+			continue
+		}
+		if stats.Unique == 0 {
+			stats.Min = s.min
+		}
+		stats.Max = s.max
+		stats.Unique += s.count
+		stats.Distinct24 += s.distinct24
+		stats.NonEmptyShards++
+	}
+	return stats
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func fillStatsBitmap(bitmap *Bitmap) {
+	r := rand.New(rand.NewPCG(13, 14))
+	for range 1 << 16 {
+		bitmap.Add(uint32(r.IntN(190)+10)<<24 | r.Uint32()&0xFFFFFF) // 10.x - 199.x
+	}
+	bitmap.Add(0x0A000001)
+	bitmap.Add(0x0A000002) // same /24
+}
+
+// The single pass agrees with every metric computed on its own
+func TestBitmapStats(t *testing.T) {
+	bitmap := newTestBitmap(t)
+	if stats := bitmap.Stats(); stats.Unique != 0 || stats.NonEmptyShards != 0 || stats.Distinct24 != 0 {
+		t.Errorf("empty bitmap: %+v", stats)
+	}
+
+	fillStatsBitmap(bitmap)
+	stats := bitmap.Stats()
+	minIP, _ := bitmap.Min()
+	maxIP, _ := bitmap.Max()
+	if stats.Unique != bitmap.Count() || stats.Min != minIP || stats.Max != maxIP {
+		t.Errorf("unique %d, range %x-%x, want %d, %x-%x", stats.Unique, stats.Min, stats.Max, bitmap.Count(), minIP, maxIP)
+	}
+	if stats.PerShard != getHistogram(bitmap) {
+		t.Error("per /8 counts differ from the histogram")
+	}
+	if empty := len(getEmptyShards(bitmap)); stats.NonEmptyShards != OCTET_MAX_VALUE-empty {
+		t.Errorf("%d non-empty shards, %d empty ones", stats.NonEmptyShards, empty)
+	}
+
+	distinct24 := uint64(0)
+	for prefix := uint32(0); prefix < 1<<24; prefix++ {
+		if countRange(bitmap, prefix<<8, prefix<<8|0xFF) > 0 {
+			distinct24++
+		}
+	}
+	if stats.Distinct24 != distinct24 {
+		t.Errorf("%d distinct /24s, want %d", stats.Distinct24, distinct24)
+	}
+}
+
+func BenchmarkBitmapStats(b *testing.B) {
+	bitmap := newTestBitmap(b)
+	fillStatsBitmap(bitmap)
+
+	b.Run("single-pass", func(b *testing.B) {
+		for b.Loop() {
+			bitmap.Stats()
+		}
+	})
+	// What Stats replaces: a pass per metric (no /24 coverage, there's no separate pass for it)
+	b.Run("separate", func(b *testing.B) {
+		for b.Loop() {
+			bitmap.Count()
+			bitmap.Min()
+			bitmap.Max()
+			getHistogram(bitmap)
+			getEmptyShards(bitmap)
+		}
+	})
+}
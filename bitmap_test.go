@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// Many workers OR overlapping addresses into the same words. With a plain |= instead of the
+// atomic OR bits get lost, so the count comes out short, and -race reports it.
+// On the Go heap on purpose: the race detector doesn't see into mmapped memory
+func TestSetBitLocalConcurrent(t *testing.T) {
+	b := new(Bitmap)
+
+	const workers = 16
+	const addresses = 1 << 14 // 256 words of one segment, every worker sets all of them
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Go(func() {
+			// Every worker walks in its own order, so they meet on the same words at the same time
+			for i := range addresses {
+				rest := uint32((i*(2*w+1) + w) % addresses)
+				setBitLocal(b, 10, rest)
+			}
+		})
+	}
+	wg.Wait()
+
+	if count := b.Count(); count != addresses {
+		t.Errorf("count = %d, want %d", count, addresses)
+	}
+}
+
+// Addresses of one 64 address block share a uint64, setting one must keep the others
+func TestSetBitLocalSameWord(t *testing.T) {
+	tests := []struct {
+		name string
+		ips  []uint32
+	}{
+		{"neighbours", []uint32{0x0A000000, 0x0A000001}},
+		{"first and last bit", []uint32{0x0A000040, 0x0A00007F}},
+		{"whole word", func() []uint32 {
+			ips := make([]uint32, 64)
+			for i := range ips {
+				ips[i] = 0xC0A80100 + uint32(i)
+			}
+			return ips
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBitmap(t)
+			for _, ip := range test.ips {
+				setBitLocal(b, byte(ip>>24), ip&0xFFFFFF)
+			}
+			for _, ip := range test.ips {
+				if !b.Contains(ip) {
+					t.Errorf("%08X lost", ip)
+				}
+			}
+			if count := b.Count(); count != uint64(len(test.ips)) {
+				t.Errorf("count = %d, want %d", count, len(test.ips))
+			}
+		})
+	}
+}
+
+// Reusing a bitmap: Reset clears 512 MB in parallel
+func BenchmarkBitmapReset(b *testing.B) {
+	bitmap := newTestBitmap(b)
+	bitmap.Add(0x0A000001)
+	b.SetBytes(int64(unsafe.Sizeof(Bitmap{})))
+	for b.Loop() {
+		bitmap.Reset()
+	}
+}
+
+// What Reset saves: a fresh mapping, every page of it faulted in as a full count would, and unmapped
+func BenchmarkBitmapAlloc(b *testing.B) {
+	b.SetBytes(int64(unsafe.Sizeof(Bitmap{})))
+	for b.Loop() {
+		bitmap, err := allocateBitmap()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for octet := range bitmap.segments {
+			for i := 0; i < BITMAP_SEGMENT_SIZE; i += 512 { // one word per 4 KB page
+				bitmap.segments[octet][i] = 1
+			}
+		}
+		freeBitmap(bitmap)
+	}
+}
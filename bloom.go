@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Saved Bloom filter: magic, hash count (uint32), bit count (uint64), bit words, all little endian
+const BLOOM_FILE_MAGIC = "IPV4BLM1"
+
+// Compact "have we seen this address" artifact, much smaller than the 512 MB bitmap
+type BloomFilter struct {
+	hashes uint32
+	bits   uint64
+	words  []uint64
+}
+
+// Optimal size for n elements and false positive rate fp
+func NewBloomFilter(n uint64, fp float64) *BloomFilter {
+	n = max(n, 1)
+	bitsAmount := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	bitsAmount = max(bitsAmount, 64)
+	hashes := uint32(max(1, math.Round(float64(bitsAmount)/float64(n)*math.Ln2)))
+
+	return &BloomFilter{
+		hashes: hashes,
+		bits:   bitsAmount,
+		words:  make([]uint64, (bitsAmount+63)/64),
+	}
+}
+
+// Double hashing: i-th position is h1 + i*h2
+func (b *BloomFilter) positions(ip uint32, fn func(position uint64) bool) {
+	h1 := hashIP(ip, DEFAULT_HASH_SEED)
+	h2 := hashIP(ip, ^uint64(DEFAULT_HASH_SEED)) | 1
+
+	for i := uint32(0); i < b.hashes; i++ {
+		if !fn((h1 + uint64(i)*h2) % b.bits) {
+			return
+		}
+	}
+}
+
+func (b *BloomFilter) Add(ip uint32) {
+	b.positions(ip, func(position uint64) bool {
+		b.words[position>>6] |= 1 << (position & 63)
+		return true
+	})
+}
+
+// False means definitely not seen, true means seen with the configured false positive rate
+func (b *BloomFilter) Contains(ip uint32) bool {
+	found := true
+	b.positions(ip, func(position uint64) bool {
+		found = b.words[position>>6]&(1<<(position&63)) != 0
+		return found
+	})
+	return found
+}
+
+// Sized for the observed cardinality, filled by walking the bitmap
+func buildBloomFilter(bitmap *Bitmap, unique uint64, fp float64) *BloomFilter {
+	bloom := NewBloomFilter(unique, fp)
+	for octet := 0; octet < OCTET_MAX_VALUE; octet++ {
+		walkSegment(bitmap, octet, bloom.Add)
+	}
+	return bloom
+}
+
+func SaveBloomFilter(bloom *BloomFilter, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString(BLOOM_FILE_MAGIC)
+	binary.Write(writer, binary.LittleEndian, bloom.hashes)
+	binary.Write(writer, binary.LittleEndian, bloom.bits)
+	if err := binary.Write(writer, binary.LittleEndian, bloom.words); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func LoadBloomFilter(filename string) (*BloomFilter, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic := make([]byte, len(BLOOM_FILE_MAGIC))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != BLOOM_FILE_MAGIC {
+		return nil, fmt.Errorf("%s: not a saved Bloom filter", filename)
+	}
+
+	bloom := &BloomFilter{}
+	binary.Read(reader, binary.LittleEndian, &bloom.hashes)
+	if err := binary.Read(reader, binary.LittleEndian, &bloom.bits); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if bloom.hashes == 0 || bloom.bits == 0 {
+		return nil, fmt.Errorf("%s: %w", filename, errors.New("corrupted Bloom filter header"))
+	}
+
+	bloom.words = make([]uint64, (bloom.bits+63)/64)
+	if err := binary.Read(reader, binary.LittleEndian, bloom.words); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return bloom, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+var errUTF16 = errors.New("input is UTF-16 (byte order mark found), convert it to ASCII/UTF-8 first")
+
+// UTF-8 BOM from Windows tools is harmless and just cut off.
+// UTF-16 would be parsed as garbage, so it's an error
+func stripBOM(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return data[len(utf8BOM):], nil
+	}
+	if len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF) {
+		return nil, errUTF16
+	}
+	return data, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestStripBOM(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  error
+	}{
+		{"no BOM", []byte("1.1.1.1\n"), []byte("1.1.1.1\n"), nil},
+		{"UTF-8 BOM", []byte("\xEF\xBB\xBF1.1.1.1\n"), []byte("1.1.1.1\n"), nil},
+		{"only a BOM", []byte("\xEF\xBB\xBF"), []byte{}, nil},
+		{"UTF-16LE", []byte("\xFF\xFE1\x00"), nil, errUTF16},
+		{"UTF-16BE", []byte("\xFE\xFF\x001"), nil, errUTF16},
+		{"part of a BOM", []byte("\xEF\xBB"), []byte("\xEF\xBB"), nil},
+		{"empty", []byte{}, []byte{}, nil},
+	}
+
+	for _, test := range tests {
+		got, err := stripBOM(test.data)
+		if !errors.Is(err, test.err) || !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+// The first address right after the BOM counts like any other
+func TestBOMFirstAddress(t *testing.T) {
+	resetConfig(t)
+	config.Stats = true
+	filename := writeInput(t, "bom.txt", "\xEF\xBB\xBF10.0.0.1\n10.0.0.2\n")
+	b := newTestBitmap(t)
+
+	count, stats, err := countUniqueIPsChecked([]string{filename}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || stats.Malformed != 0 || !b.Contains(0x0A000001) {
+		t.Errorf("count %d, malformed %d, 10.0.0.1 counted %v", count, stats.Malformed, b.Contains(0x0A000001))
+	}
+}
+
+// -input-encoding utf16le/utf16be decodes to the same text, BOM or not
+func TestUTF16Decoding(t *testing.T) {
+	const text = "10.0.0.1\r\n10.0.0.2\n"
+	encode := func(bigEndian, bom bool) []byte {
+		units := utf16.Encode([]rune(text))
+		if bom {
+			units = append([]uint16{0xFEFF}, units...)
+		}
+		var out []byte
+		for _, u := range units {
+			if bigEndian {
+				out = append(out, byte(u>>8), byte(u))
+			} else {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		}
+		return out
+	}
+
+	for _, encoding := range []string{ENCODING_UTF16LE, ENCODING_UTF16BE} {
+		for _, bom := range []bool{true, false} {
+			data := encode(encoding == ENCODING_UTF16BE, bom)
+			got, err := io.ReadAll(wrapDecoder(bytes.NewReader(data), encoding))
+			if err != nil || string(got) != text {
+				t.Errorf("%s, BOM %v: got %q, %v", encoding, bom, got, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// Longer malformed lines are cut in -max-examples, a garbage "line" can be the whole file
+const MAX_EXAMPLE_LENGTH = 200
+
+// Line counters of the validating path
+type LineStats struct {
+	Lines         uint64  `json:"lines"`
+	Malformed     uint64  `json:"malformed"`
+	MalformedRate float64 `json:"malformed_rate"`
+
+	// Address family of every non-blank line. IPv6 and other lines are also counted as malformed,
+	// except IPv6 in -ipv6 mode
+	IPv4  uint64 `json:"ipv4"`
+	IPv6  uint64 `json:"ipv6"`
+	Other uint64 `json:"other"`
+
+	Hostnames uint64 `json:"hostnames,omitempty"` // -resolve, not malformed
+	TooLong   uint64 `json:"too_long,omitempty"`  // over -max-line-length, also malformed and other
+
+	// First -max-examples malformed lines, only with -stats
+	Examples []MalformedExample `json:"malformed_examples,omitempty"`
+}
+
+type MalformedExample struct {
+	Line    uint64 `json:"line"`
+	Content string `json:"content"`
+}
+
+func (s *LineStats) add(other *LineStats) {
+	s.Lines += other.Lines
+	s.Malformed += other.Malformed
+	s.IPv4 += other.IPv4
+	s.IPv6 += other.IPv6
+	s.Other += other.Other
+	s.Hostnames += other.Hostnames
+	s.TooLong += other.TooLong
+
+	// Chunks finish in any order, so the first N are picked by line number, not by arrival.
+	// Every chunk brings at most N, the kept list never grows past 2N
+	if len(other.Examples) > 0 {
+		s.Examples = append(s.Examples, other.Examples...)
+		slices.SortFunc(s.Examples, func(a, b MalformedExample) int {
+			if c := cmp.Compare(a.Line, b.Line); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Content, b.Content) // same line of another file
+		})
+		s.Examples = s.Examples[:min(len(s.Examples), config.MaxExamples)]
+	}
+}
+
+func (s *LineStats) finish() {
+	if s.Lines > 0 {
+		s.MalformedRate = float64(s.Malformed) / float64(s.Lines)
+	}
+}
+
+// Validating parser: exactly 4 octets of 1-3 digits, each <= 255.
+// Surrounding spaces, tabs and '\r' are ignored
+func parseIPv4Strict(data []byte, start, end int) (uint32, bool) {
+	for start < end && isSpace(data[start]) {
+		start++
+	}
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+
+	var ip, currentOctet uint32
+	octetIndex, digits := 0, 0
+
+	for i := start; i < end; i++ {
+		c := data[i]
+
+		if c == '.' {
+			if digits == 0 || octetIndex == 3 {
+				return 0, false
+			}
+			ip = ip<<8 | currentOctet
+			currentOctet, digits = 0, 0
+			octetIndex++
+			continue
+		}
+
+		if c < '0' || c > '9' || digits == 3 {
+			return 0, false
+		}
+		currentOctet = currentOctet*10 + uint32(c-'0')
+		if currentOctet > 255 {
+			return 0, false
+		}
+		digits++
+	}
+
+	if octetIndex != 3 || digits == 0 {
+		return 0, false
+	}
+	return ip<<8 | currentOctet, true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// Slower path for when we need to know about bad lines: every line is validated,
+// malformed ones are counted and skipped instead of being parsed into garbage.
+// With cancel set (-strict-errexit) the first malformed line stops the chunk instead
+func processChunkChecked(data []byte, chunk task, counter Counter, stats *LineStats, cancel *cancellation) {
+	lineStart := chunk.start
+	line := chunk.line + uint64(config.SkipHeader) + uint64(config.LineBase) // global, header lines included
+	maxLine := config.lineLengthLimit()
+
+	var rejected []byte
+	if rejects != nil {
+		defer func() { rejects.write(rejected) }()
+	}
+
+	for i := chunk.start; i <= chunk.end; i++ {
+		if i < chunk.end && data[i] != '\n' {
+			continue
+		}
+
+		if i-lineStart > maxLine {
+			// Not even looked at, a blob without newlines isn't worth parsing
+			stats.Lines++
+			stats.Malformed++
+			stats.Other++
+			stats.TooLong++
+			if rejects != nil {
+				rejected = appendReject(rejected, line, data[lineStart:lineStart+maxLine])
+			}
+			if config.keepsExamples() && len(stats.Examples) < config.MaxExamples {
+				stats.Examples = append(stats.Examples, MalformedExample{Line: line, Content: string(data[lineStart : lineStart+min(maxLine, MAX_EXAMPLE_LENGTH)])})
+			}
+		} else if !isBlankLine(data, lineStart, i) {
+			stats.Lines++
+			if ip, ok := parseLineIPv4(data, lineStart, i); ok {
+				// Address of another /8 is valid, just not interesting
+				if config.Prefix < 0 || ip>>24 == uint32(config.Prefix) {
+					counter.Add(ip)
+					if frequencies != nil {
+						frequencies.Add(ip, line)
+					}
+					if groups != nil {
+						groups.add(data, lineStart, i, ip)
+					}
+				}
+				stats.IPv4++
+			} else if ipv6 != nil && ipv6.add(data, lineStart, i, counter) {
+				stats.IPv6++
+			} else if resolver != nil && resolver.collect(data, lineStart, i) {
+				stats.Hostnames++
+			} else if cancel != nil {
+				cancel.fail(&MalformedLineError{
+					Line:    line,
+					Content: string(data[lineStart:i]),
+					file:    chunk.file,
+					chunk:   chunk.index,
+				})
+				return
+			} else {
+				stats.Malformed++
+				if rejects != nil {
+					rejected = appendReject(rejected, line, data[lineStart:i])
+					if len(rejected) >= REJECT_FLUSH_SIZE {
+						rejects.write(rejected)
+						rejected = rejected[:0]
+					}
+				}
+				if config.keepsExamples() && len(stats.Examples) < config.MaxExamples {
+					content := data[lineStart:i]
+					stats.Examples = append(stats.Examples, MalformedExample{Line: line, Content: string(content[:min(len(content), MAX_EXAMPLE_LENGTH)])})
+				}
+				if looksLikeIPv6(data, lineStart, i) {
+					stats.IPv6++
+				} else {
+					stats.Other++
+				}
+			}
+		}
+		lineStart = i + 1
+		line++
+
+		if cancel != nil && stats.Lines%CANCEL_CHECK_LINES == 0 && cancel.stopped(chunk.file, chunk.index) {
+			return
+		}
+	}
+}
+
+// Cheap family guess, not a validation: IPv6 is the only form with ':' and hex digits only
+func looksLikeIPv6(data []byte, start, end int) bool {
+	colons := 0
+	for i := start; i < end; i++ {
+		c := data[i]
+		switch {
+		case c == ':':
+			colons++
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == '.', isSpace(c):
+		default:
+			return false
+		}
+	}
+	return colons >= 2
+}
+
+// Parses the whole line or only the -col field of it
+func parseLineIPv4(data []byte, start, end int) (uint32, bool) {
+	if config.Column > 0 {
+		var ok bool
+		start, end, ok = getField(data, start, end, config.Column, config.FieldSep)
+		if !ok {
+			return 0, false
+		}
+	}
+	return parseIPv4Strict(data, start, end)
+}
+
+func isBlankLine(data []byte, start, end int) bool {
+	for i := start; i < end; i++ {
+		if !isSpace(data[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func countUniqueIPsChecked(filenames []string, counter Counter) (uint64, *LineStats, error) {
+	total := &LineStats{}
+	var mu sync.Mutex
+
+	if config.StrictErrexit {
+		errexit = newCancellation()
+		defer func() { errexit = nil }()
+	}
+	cancel := errexit
+
+	// Stats of a file join the total only once it counts: with -file-timeout
+	// an abandoned worker goes on adding to its own file's stats, never to the total
+	processFilesInto(filenames, counter, func(counter Counter) (func(data []byte, chunk task), func()) {
+		file := &LineStats{}
+		var fileMu sync.Mutex
+
+		process := func(data []byte, chunk task) {
+			local := LineStats{}
+			worker, done := workerCounter(counter)
+			processChunkChecked(data, chunk, worker, &local, cancel)
+			done()
+
+			fileMu.Lock()
+			file.add(&local)
+			fileMu.Unlock()
+		}
+		done := func() {
+			mu.Lock()
+			total.add(file)
+			mu.Unlock()
+		}
+		return process, done
+	})
+
+	if cancel != nil && cancel.err != nil {
+		cancel.err.File = filenames[cancel.err.file]
+		return 0, nil, cancel.err
+	}
+	if resolver != nil {
+		resolver.resolve(counter, config.ResolveTimeout)
+	}
+
+	total.finish()
+	return countCounter(counter), total, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import "math/bits"
+
+// -churn: how the set of yesterday (A) turned into today (B)
+type ChurnResult struct {
+	Retained uint64  `json:"retained"` // |A ∩ B|
+	Removed  uint64  `json:"removed"`  // |A \ B|
+	Added    uint64  `json:"added"`    // |B \ A|
+	Jaccard  float64 `json:"jaccard"`  // |A ∩ B| / |A ∪ B|, 1 for two empty sets
+}
+
+// One parallel pass popcounting AND / AND NOT of every word pair, neither bitmap is modified
+func getChurn(yesterday, today *Bitmap) ChurnResult {
+	var retained, removed, added [OCTET_MAX_VALUE]uint64
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			for j, a := range &yesterday.segments[i] {
+				b := today.segments[i][j]
+				retained[i] += uint64(bits.OnesCount64(a & b))
+				removed[i] += uint64(bits.OnesCount64(a &^ b))
+				added[i] += uint64(bits.OnesCount64(b &^ a))
+			}
+		}
+	})
+
+	churn := ChurnResult{Jaccard: 1}
+	for i := range retained {
+		churn.Retained += retained[i]
+		churn.Removed += removed[i]
+		churn.Added += added[i]
+	}
+	if union := churn.Retained + churn.Removed + churn.Added; union > 0 {
+		churn.Jaccard = float64(churn.Retained) / float64(union)
+	}
+	return churn
+}
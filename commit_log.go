@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Commit log: magic, then records of addresses that were new to the bitmap, as sorted runs:
+// [run count uint32][first uint32, length - 1 uint32]...[CRC-32C of the runs], little endian.
+// A crash can leave a torn last record, replay stops at the first record that doesn't check out
+const COMMIT_LOG_MAGIC = "IPV4LOG1"
+
+// Workers hand new addresses to the log in batches of up to this size, and at every tick
+const COMMIT_LOG_BATCH = 64 << 10
+
+const DEFAULT_COMMIT_INTERVAL = time.Second
+
+var errNotCommitLog = errors.New("not a commit log")
+
+// Set in main with -commit-log, nil otherwise
+var commitLog *CommitLog
+
+// Pending addresses are written as one record and fsynced every interval. Worker batches are
+// handed over on their first address after a tick, so they make it into the next record:
+// a crash loses at most the last two intervals. Every fsync is a disk flush: shorter intervals
+// cost throughput on spinning disks and network storage, longer ones lose more
+type CommitLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	pending []uint32
+	ticks   atomic.Uint64 // intervals so far, a worker batch older than a tick is handed over
+	err     error         // first write error, reported by Close
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// end is where the last whole record ends (from replayCommitLog), a torn tail is cut off
+// so new records don't land behind it. 0 - a new log
+func OpenCommitLog(filename string, end int64, interval time.Duration) (*CommitLog, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if end == 0 {
+		if _, err := file.WriteString(COMMIT_LOG_MAGIC); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	l := &CommitLog{file: file, done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(l.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				l.ticks.Add(1)
+				l.sync()
+			case <-l.done:
+				return
+			}
+		}
+	}()
+	return l, nil
+}
+
+func (l *CommitLog) append(ips ...uint32) {
+	l.mu.Lock()
+	l.pending = append(l.pending, ips...)
+	l.mu.Unlock()
+}
+
+// Writes everything pending as one record and fsyncs it
+func (l *CommitLog) sync() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	_, err := l.file.Write(encodeCommitRecord(pending))
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.mu.Lock()
+		if l.err == nil {
+			l.err = err
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Stops the ticker and syncs the rest
+func (l *CommitLog) Close() error {
+	close(l.done)
+	<-l.stopped
+	l.sync()
+
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+func encodeCommitRecord(ips []uint32) []byte {
+	slices.Sort(ips)
+
+	runs := make([]byte, 0, 64)
+	count := uint32(0)
+	for i := 0; i < len(ips); {
+		j := i + 1
+		for j < len(ips) && ips[j] == ips[j-1]+1 {
+			j++
+		}
+		runs = binary.LittleEndian.AppendUint32(runs, ips[i])
+		runs = binary.LittleEndian.AppendUint32(runs, uint32(j-i-1))
+		count++
+		i = j
+	}
+
+	record := binary.LittleEndian.AppendUint32(make([]byte, 0, len(runs)+8), count)
+	record = append(record, runs...)
+	return binary.LittleEndian.AppendUint32(record, crc32.Checksum(runs, CRC32C))
+}
+
+// Sets every address of the log in bitmap, returns how many addresses the log holds.
+// A missing log is an empty one, a torn last record (crash mid-write) is skipped
+func ReplayCommitLog(bitmap *Bitmap, filename string) (uint64, error) {
+	addresses, _, err := replayCommitLog(bitmap, filename)
+	return addresses, err
+}
+
+// Also returns where the last whole record ends
+func replayCommitLog(bitmap *Bitmap, filename string) (uint64, int64, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	magic := make([]byte, len(COMMIT_LOG_MAGIC))
+	if n, err := io.ReadFull(reader, magic); n == 0 && err == io.EOF {
+		return 0, 0, nil
+	} else if err != nil || string(magic) != COMMIT_LOG_MAGIC {
+		return 0, 0, fmt.Errorf("%s: %w", filename, errNotCommitLog)
+	}
+
+	addresses := uint64(0)
+	end := int64(len(COMMIT_LOG_MAGIC))
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return addresses, end, nil // clean end or a torn header
+		}
+		size := int64(binary.LittleEndian.Uint32(header[:]))*8 + 4
+		if end+int64(len(header))+size > fileInfo.Size() {
+			return addresses, end, nil // torn record, its length may be garbage too
+		}
+		runs := make([]byte, size)
+		if _, err := io.ReadFull(reader, runs); err != nil {
+			return addresses, end, nil
+		}
+		checksum := binary.LittleEndian.Uint32(runs[len(runs)-4:])
+		runs = runs[:len(runs)-4]
+		if crc32.Checksum(runs, CRC32C) != checksum {
+			return addresses, end, nil
+		}
+		end += int64(len(header)) + size
+
+		for i := 0; i < len(runs); i += 8 {
+			first := binary.LittleEndian.Uint32(runs[i:])
+			length := uint64(binary.LittleEndian.Uint32(runs[i+4:])) + 1
+			for ip := uint64(first); ip < uint64(first)+length; ip++ {
+				bitmap.Add(uint32(ip))
+			}
+			addresses += length
+		}
+	}
+}
+
+// After a checkpoint (-append-save) everything logged is in the saved bitmap, the log starts over
+func truncateCommitLog(filename string) error {
+	return os.Truncate(filename, int64(len(COMMIT_LOG_MAGIC)))
+}
+
+// Rebuilds the bitmap after a crash: the last saved bitmap (checkpoint) plus everything logged since
+func RebuildFromCommitLog(baseline, log string) (*Bitmap, error) {
+	bitmap, err := LoadBitmap(baseline)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ReplayCommitLog(bitmap, log); err != nil {
+		return nil, err
+	}
+	return bitmap, nil
+}
+
+// Innermost wrapper: addresses new to the bitmap go to the log in batches of limit.
+// Without a limit every address goes right away and the counter is safe for concurrent use
+type commitLogCounter struct {
+	bitmap *Bitmap
+	log    *CommitLog
+	batch  []uint32
+	limit  int
+	tick   uint64 // of the log when the batch was last handed over
+}
+
+func newCommitLogCounter(bitmap *Bitmap, log *CommitLog, limit int) *commitLogCounter {
+	return &commitLogCounter{bitmap: bitmap, log: log, batch: make([]uint32, 0, limit), limit: limit, tick: log.ticks.Load()}
+}
+
+func (c *commitLogCounter) Add(ip uint32) {
+	// A chunk can take longer than an interval, its batch mustn't wait for the chunk's end
+	if len(c.batch) > 0 && c.log.ticks.Load() != c.tick {
+		c.flush()
+	}
+	if !c.bitmap.AddNew(ip) {
+		return
+	}
+	if c.limit == 0 {
+		c.log.append(ip)
+		return
+	}
+	c.batch = append(c.batch, ip)
+	if len(c.batch) == c.limit {
+		c.flush()
+	}
+}
+
+func (c *commitLogCounter) Count() uint64 {
+	return c.bitmap.Count()
+}
+
+func (c *commitLogCounter) flush() {
+	c.log.append(c.batch...)
+	c.batch = c.batch[:0]
+	c.tick = c.log.ticks.Load()
+}
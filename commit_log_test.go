@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A worker batch goes to the log at the first address after a tick, not only when full or at the chunk's end
+func TestCommitLogBatchHandedOverOnTick(t *testing.T) {
+	resetConfig(t)
+	log, err := OpenCommitLog(filepath.Join(t.TempDir(), "ips.log"), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	c := newCommitLogCounter(newTestBitmap(t), log, COMMIT_LOG_BATCH)
+
+	pending := func() []uint32 {
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		return slices.Clone(log.pending)
+	}
+
+	c.Add(1)
+	c.Add(2)
+	c.Add(1)
+	if got := pending(); len(got) != 0 {
+		t.Fatalf("handed over %v before a tick", got)
+	}
+
+	log.ticks.Add(1) // as the ticker does before a sync
+	c.Add(1)         // not even new
+	if got := pending(); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("after a tick: pending %v, want [1 2]", got)
+	}
+
+	c.Add(3)
+	c.flush()
+	if got := pending(); !slices.Equal(got, []uint32{1, 2, 3}) {
+		t.Errorf("at the chunk's end: pending %v, want [1 2 3]", got)
+	}
+}
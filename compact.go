@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Compact saved bitmap: magic, then only non-empty segments as [octet][container type][container],
+// then the CRC-32C of everything between the magic and itself (uint32). Container is whichever
+// is smaller: the raw segment (2 MB of little endian words) or the count and uvarint deltas of set addresses.
+// Files of the first version end right after the segments and are still loaded, just unverified
+const BITMAP_COMPACT_MAGIC = "IPV4BMC2"
+const BITMAP_COMPACT_MAGIC_V1 = "IPV4BMC1"
+
+const (
+	CONTAINER_BITMAP = 0
+	CONTAINER_DELTAS = 1
+)
+
+const SEGMENT_BYTES = BITMAP_SEGMENT_SIZE * 8
+
+func SaveBitmapCompact(bitmap *Bitmap, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(BITMAP_COMPACT_MAGIC); err != nil {
+		return err
+	}
+	checksum := crc32.New(CRC32C)
+	writer := bufio.NewWriterSize(io.MultiWriter(file, checksum), 1<<20)
+
+	deltas := make([]byte, 0, SEGMENT_BYTES)
+	for octet := range bitmap.segments {
+		count := countSegmentBits(bitmap, octet)
+		if count == 0 {
+			continue
+		}
+
+		// Every delta takes at least a byte, so dense segments don't even try
+		deltas = deltas[:0]
+		if count < SEGMENT_BYTES {
+			deltas = binary.AppendUvarint(deltas, count)
+			prev := uint32(0)
+			walkSegment(bitmap, octet, func(ip uint32) {
+				deltas = binary.AppendUvarint(deltas, uint64(ip&0xFFFFFF-prev))
+				prev = ip & 0xFFFFFF
+			})
+		}
+
+		writer.WriteByte(byte(octet))
+		if count < SEGMENT_BYTES && len(deltas) < SEGMENT_BYTES {
+			writer.WriteByte(CONTAINER_DELTAS)
+			writer.Write(deltas)
+			continue
+		}
+
+		writer.WriteByte(CONTAINER_BITMAP)
+		var word [8]byte
+		for _, w := range &bitmap.segments[octet] {
+			binary.LittleEndian.PutUint64(word[:], w)
+			writer.Write(word[:])
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.Write(binary.LittleEndian.AppendUint32(nil, checksum.Sum32())); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Rest of a compact file after the magic, size bytes. Segments that aren't in the file are cleared.
+// With verified set the last 4 bytes are the checksum, a mismatch fails with errBitmapChecksum
+func readBitmapCompact(bitmap *Bitmap, r io.Reader, size int64, verified bool) error {
+	bitmap.Reset()
+	checksum := crc32.New(CRC32C)
+	body := r
+	if verified {
+		if size < 4 {
+			return io.ErrUnexpectedEOF
+		}
+		// Limited, so the buffered reader never reads into the checksum
+		body = io.TeeReader(io.LimitReader(r, size-4), checksum)
+	}
+	reader := bufio.NewReaderSize(body, 1<<20)
+
+	err := readCompactSegments(bitmap, reader)
+	if !verified {
+		return err
+	}
+
+	// A corrupted body may fail to parse before its end, corruption is still what gets reported
+	io.Copy(io.Discard, reader)
+	var saved [4]byte
+	if _, err := io.ReadFull(r, saved[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if binary.LittleEndian.Uint32(saved[:]) != checksum.Sum32() {
+		return errBitmapChecksum
+	}
+	return err
+}
+
+func readCompactSegments(bitmap *Bitmap, reader *bufio.Reader) error {
+	for {
+		octet, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		container, err := reader.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		segment := &bitmap.segments[octet]
+		switch container {
+		case CONTAINER_BITMAP:
+			var word [8]byte
+			for j := range segment {
+				if _, err := io.ReadFull(reader, word[:]); err != nil {
+					return io.ErrUnexpectedEOF
+				}
+				segment[j] = binary.LittleEndian.Uint64(word[:])
+			}
+		case CONTAINER_DELTAS:
+			count, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			offset := uint64(0)
+			for ; count > 0; count-- {
+				delta, err := binary.ReadUvarint(reader)
+				if err != nil {
+					return io.ErrUnexpectedEOF
+				}
+				offset += delta
+				if offset >= BITMAP_SEGMENT_SIZE*64 {
+					return fmt.Errorf("segment %d: address offset %d out of range", octet, offset)
+				}
+				segment[offset>>6] |= uint64(1) << (offset & 63)
+			}
+		default:
+			return fmt.Errorf("segment %d: unknown container type %d", octet, container)
+		}
+	}
+}
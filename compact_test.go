@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+)
+
+// save -> load gives back the same bits, whichever containers the segments end up in
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		fill func(b *Bitmap)
+	}{
+		{"empty", func(b *Bitmap) {}},
+		{"sparse", func(b *Bitmap) {
+			r := rand.New(rand.NewPCG(7, 8))
+			for range 10000 {
+				b.Add(r.Uint32())
+			}
+			b.Add(0)
+			b.Add(0xFFFFFFFF)
+		}},
+		{"one dense segment", func(b *Bitmap) {
+			for i := range b.segments[10] {
+				b.segments[10][i] = 0x5555555555555555
+			}
+			b.Add(0xC0A80101)
+		}},
+		{"near full", func(b *Bitmap) {
+			for octet := range b.segments {
+				for i := range b.segments[octet] {
+					b.segments[octet][i] = ^uint64(0)
+				}
+			}
+			b.segments[0][0] = 0
+			b.segments[200][1000] &^= 1 << 7
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := newTestBitmap(t)
+			test.fill(saved)
+			filename := filepath.Join(t.TempDir(), "compact.bin")
+			if err := SaveBitmapCompact(saved, filename); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := newTestBitmap(t)
+			loaded.Add(0x01020304) // whatever was there is overwritten
+			if err := loadBitmapInto(loaded, filename); err != nil {
+				t.Fatal(err)
+			}
+			if loaded.segments != saved.segments {
+				t.Errorf("loaded %d addresses, saved %d", loaded.Count(), saved.Count())
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const DEFAULT_CONFIDENCE = 0.95
+
+// Approximate backends expose their relative standard error, exact ones don't implement it
+type Estimator interface {
+	StandardError() float64
+}
+
+// estimate ± margin at the given level, margin = z * standard error * estimate
+type ConfidenceInterval struct {
+	Level         float64 `json:"level"`
+	StandardError float64 `json:"standard_error"` // relative
+	Margin        uint64  `json:"margin"`
+	Low           uint64  `json:"low"`
+	High          uint64  `json:"high"`
+}
+
+// Normal approximation: z is the two-sided quantile of the level (1.96 for 95%)
+func getConfidence(estimate uint64, standardError, level float64) *ConfidenceInterval {
+	z := math.Sqrt2 * math.Erfinv(level)
+	margin := uint64(z*standardError*float64(estimate) + 0.5)
+	return &ConfidenceInterval{
+		Level:         level,
+		StandardError: standardError,
+		Margin:        margin,
+		Low:           estimate - min(margin, estimate),
+		High:          estimate + margin,
+	}
+}
+
+func parseConfidence(value string) (float64, error) {
+	var level float64
+	if _, err := fmt.Sscan(value, &level); err != nil || level <= 0 || level >= 1 {
+		return 0, fmt.Errorf("confidence must be between 0 and 1, e.g. 0.95")
+	}
+	return level, nil
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// All command line options in one place
+type Config struct {
+	Debug                  bool
+	EstimateRun            bool
+	VerifyChecksum         bool
+	ParallelCountThreshold int64
+	WarmupRuns             int
+	MeasureRuns            int // > 0 - benchmark mode
+	Workers                int // 0 - RecommendWorkers by file size
+	MergeWorkers           int // 0 - WORKERS_SUM_AMOUNT
+	Pin                    bool
+	ParallelFiles          int
+	Single                 bool
+	Incremental            bool
+	JSON                   bool
+	JSONFull               bool
+	ConfigFile             string
+	StdoutBuffered         bool
+	MmapAdvise             string
+	Deadline               time.Duration
+	FileTimeout            time.Duration
+	PerFileDups            bool
+	Mask                   int
+	FD                     int
+	Template               *template.Template // nil - default output
+	Human                  bool
+	Expect                 *uint64 // nil when not set, zero is a valid expectation
+
+	Timeout        time.Duration
+	RawBinary      bool
+	MultiPerLine   bool
+	LittleEndian   bool
+	ListBinary     bool
+	Listen         string
+	Follow         bool
+	FlushInterval  time.Duration
+	FlushFile      string
+	FlushExact     bool
+	CommitLog      string
+	From0          string
+	ParseOnly      bool
+	CommitInterval time.Duration
+
+	StreamWindow    time.Duration
+	StreamInterval  time.Duration
+	TimestampColumn int
+	HeadBytes       int64
+	InputEncoding   string
+	SkipHeader      int
+	Prefix          int // first octet to count, -1 - all
+	Column          int // 1-based, 0 - the whole line is an address
+	GroupByColumn   int
+	FieldSep        *FieldSeparators // nil - runs of whitespace
+	Allow           string
+	Block           string
+
+	Backend    string
+	Seed       uint64
+	Confidence float64
+
+	Progress       bool
+	ProgressFormat string
+	Stats          bool
+	MaxExamples    int
+	MaxLineLength  int
+	Families       bool
+	WarnThreshold  float64 // malformed / total lines, negative - disabled
+	FailOnWarn     bool
+	StrictErrexit  bool
+	RejectFile     string
+
+	Resolve        bool
+	ResolveTimeout time.Duration
+	IPv6           bool
+	Combined       bool
+	Top            int
+	WithLocations  int
+	HeavyHitters   int
+	LineBase       int
+
+	List            bool
+	ListByFrequency bool
+	ListFormat      string
+	Canonical       bool
+	DedupSorted     bool
+
+	Pairs            bool
+	CountUniquePorts bool
+	PairColumns      [2]int
+
+	Sorted       bool
+	VerifySorted bool
+
+	Save        string
+	CompactSave string
+	AppendSave  string
+	Baseline    string
+	NewVsSaved  string
+	DiffSave    string
+	MergeOnly   bool
+	Churn       bool
+	Window      int
+
+	Repl bool
+
+	HistogramOut string
+	HistogramAll bool
+	Heatmap      string
+	EmptyShards  bool
+	Fingerprint  bool
+
+	Bloom   string
+	BloomFP float64
+
+	SplitOutput      string
+	SplitOutputEmpty bool
+}
+
+var config Config
+
+func parseFlags() {
+	defineFlags()
+	flag.Parse()
+
+	if err := loadSettings(); err != nil {
+		fatal(err)
+	}
+	applyImpliedFlags()
+}
+
+// Flags with their defaults, separate from parsing so tests get the defaults too
+func defineFlags() {
+	flag.BoolVar(&config.Debug, "debug", false, "Run internal invariant checks and print debug info")
+	flag.IntVar(&config.WarmupRuns, "warmup-runs", 0, "Benchmark mode: unmeasured runs before -measure-runs")
+	flag.BoolVar(&config.ParseOnly, "parse-only", false, "Benchmark mode: parse every line but count nothing, report the parsing rate alone")
+	flag.IntVar(&config.MeasureRuns, "measure-runs", 0, "Benchmark mode: count the input M times and report min/median/max time and throughput")
+	flag.IntVar(&config.Workers, "workers", 0, "Processing workers (default depends on file size and CPUs)")
+	flag.BoolVar(&config.Pin, "pin", false, "Linux: lock every chunk worker to its own thread and that thread to its own CPU")
+	flag.IntVar(&config.MergeWorkers, "merge-workers", 0, "Workers ORing whole bitmaps together: -merge-only, -append-save, -window, -baseline (default one per CPU)")
+	flag.BoolVar(&config.Single, "single", false, "Reference mode: one goroutine, no atomics, one sequential pass")
+	flag.BoolVar(&config.Incremental, "incremental", false, "With several files, report the cumulative unique count and the new addresses after each file")
+	flag.IntVar(&config.ParallelFiles, "parallel-files", 1, "Files processed at once when several are given, each with its own workers")
+	flag.BoolVar(&config.VerifyChecksum, "verify-checksum", false, "Arguments are saved bitmaps: check their checksums without counting anything")
+	flag.BoolVar(&config.EstimateRun, "estimate-run", false, "Predict memory and time from a sample of the file without counting")
+	flag.IntVar(&config.FD, "fd", -1, "Also read the already open file descriptor N (regular file, pipe or socket)")
+	flag.BoolVar(&config.JSON, "json", false, "Print result as JSON")
+	config.MmapAdvise = MMAP_ADVISE_SEQUENTIAL
+	flag.Func("mmap-advise", "Readahead hint for mmapped input: sequential, random or normal (default sequential)", func(value string) error {
+		if err := validateMmapAdvise(value); err != nil {
+			return err
+		}
+		config.MmapAdvise = value
+		return nil
+	})
+	config.Mask = 32
+	flag.Func("mask", "Count distinct networks instead of addresses, e.g. /24 (default /32)", func(value string) error {
+		bits, err := parseMask(value)
+		if err != nil {
+			return err
+		}
+		config.Mask = bits
+		return nil
+	})
+	flag.BoolVar(&config.PerFileDups, "per-file-dups", false, "Also report every file's lines, own distinct addresses and internal duplicate rate")
+	flag.DurationVar(&config.FileTimeout, "file-timeout", 0, "Skip any file that takes longer than DURATION, the count covers only the files that finished")
+	flag.DurationVar(&config.Deadline, "deadline", 0, "Stop after DURATION, report the partial count and exit with code 6")
+	flag.BoolVar(&config.StdoutBuffered, "stdout-buffered", false, "Buffer all of stdout in 4 MB, flushed on exit and SIGINT/SIGTERM")
+	flag.BoolVar(&config.JSONFull, "json-full", false, "Validate every line and print every metric as one versioned JSON object")
+	flag.Func("template", "Go text/template for the result instead of the default output, e.g. '{{.Unique}} unique in {{.Elapsed}}'", func(value string) error {
+		tmpl, err := parseTemplate(value)
+		if err != nil {
+			return err
+		}
+		config.Template = tmpl
+		return nil
+	})
+	flag.BoolVar(&config.Human, "human", false, "Print counts with thousands separators")
+	flag.Func("expect", "Expected unique count, exit with code 3 on mismatch", func(value string) error {
+		expected, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		config.Expect = &expected
+		return nil
+	})
+	config.InputEncoding = ENCODING_UTF8
+	flag.Func("input-encoding", "Input encoding: utf8, latin1, utf16le or utf16be (default utf8)", func(value string) error {
+		if err := validateEncoding(value); err != nil {
+			return err
+		}
+		config.InputEncoding = value
+		return nil
+	})
+	flag.DurationVar(&config.Timeout, "timeout", 0, "Overall timeout for http(s) inputs, e.g. 30s (default none)")
+	flag.BoolVar(&config.MultiPerLine, "multi-per-line", false, "Every whitespace separated token of a line is an address")
+	flag.BoolVar(&config.ListBinary, "list-binary", false, "Write unique addresses as raw 4 byte big endian records in ascending order (like -list)")
+	flag.BoolVar(&config.RawBinary, "raw-binary", false, "Input is raw 4 byte big endian addresses without delimiters")
+	flag.BoolVar(&config.LittleEndian, "little-endian", false, "With -raw-binary or -list-binary, records are little endian")
+	flag.DurationVar(&config.StreamWindow, "stream-window", 0, "Read stdin until EOF, periodically printing distinct addresses seen within the last DURATION, e.g. 60s")
+	flag.DurationVar(&config.StreamInterval, "print-interval", 10*time.Second, "How often -stream-window prints the count")
+	flag.IntVar(&config.TimestampColumn, "ts-col", 0, "With -stream-window, take the time from 1-based column N (unix seconds or RFC 3339) instead of arrival time")
+	flag.StringVar(&config.Listen, "listen", "", "Count newline separated addresses sent to the Unix socket PATH until SIGTERM, instead of files")
+	flag.BoolVar(&config.Follow, "follow", false, "Count the file, then keep counting lines appended to it like tail -F until SIGTERM")
+	flag.DurationVar(&config.FlushInterval, "flush-interval", 0, "With -listen and -follow, write the running count every DURATION")
+	flag.StringVar(&config.FlushFile, "flush-file", "", "Write -flush-interval counts to FILE (replaced every tick) instead of stdout")
+	flag.StringVar(&config.From0, "from0", "", "Also count the files listed in FILE, separated by NUL bytes (find -print0)")
+	flag.StringVar(&config.CommitLog, "commit-log", "", "Append every new address to FILE (fsynced), replay it at start: a crashed run loses at most two -commit-interval")
+	flag.DurationVar(&config.CommitInterval, "commit-interval", DEFAULT_COMMIT_INTERVAL, "How often -commit-log is written and fsynced")
+	flag.BoolVar(&config.FlushExact, "flush-exact", false, "Take -flush-interval counts with a full popcount instead of the running counter")
+	flag.Int64Var(&config.ParallelCountThreshold, "parallel-count-threshold", DEFAULT_PARALLEL_COUNT_THRESHOLD, "Inputs smaller than this many bytes are counted while adding, without the parallel popcount over 512 MB (0 - never)")
+	flag.Int64Var(&config.HeadBytes, "head-bytes", 0, "Count only the first N bytes of the input (cut to the last whole line), for quick previews")
+	flag.IntVar(&config.SkipHeader, "skip-header", 0, "Skip the first N lines of the file")
+	flag.IntVar(&config.Prefix, "prefix", -1, "Count only addresses with this first octet (0-255)")
+	flag.IntVar(&config.Column, "col", 0, "Take the address from 1-based column N instead of the whole line")
+	flag.IntVar(&config.GroupByColumn, "group-by-col", 0, "Also count distinct addresses per value of 1-based column N (e.g. tenant id), needs -col")
+	flag.Func("field-sep", "Column separators for -col and -pair-cols, every byte is one, e.g. \",\", \",;\" or \"\\t\" (default runs of whitespace)", func(value string) error {
+		seps, err := parseFieldSeparator(value)
+		if err != nil {
+			return err
+		}
+		config.FieldSep = seps
+		return nil
+	})
+	flag.StringVar(&config.Allow, "allow", "", "Count only addresses listed in FILE")
+	flag.StringVar(&config.Block, "block", "", "Don't count addresses listed in FILE")
+	config.Backend = BACKEND_DENSE
+	flag.Func("backend", "Counting backend: dense (exact, 512 MB), sparse (exact, memory grows with uniques) or hll (approximate, 64 KB) (default dense)", func(value string) error {
+		if err := validateBackend(value); err != nil {
+			return err
+		}
+		config.Backend = value
+		return nil
+	})
+	config.Confidence = DEFAULT_CONFIDENCE
+	flag.Func("confidence", "Level of the interval reported around approximate counts (default 0.95)", func(value string) error {
+		level, err := parseConfidence(value)
+		config.Confidence = level
+		return err
+	})
+	flag.Uint64Var(&config.Seed, "seed", DEFAULT_HASH_SEED, "Hash seed for approximate backends, fixed by default for reproducible estimates")
+	flag.BoolVar(&config.Progress, "progress", false, "Print running lines, uniques and duplicate rate to stderr every second")
+	config.ProgressFormat = PROGRESS_PLAIN
+	flag.Func("progress-format", "Progress line: plain, eta or bar, implies -progress (default plain)", func(value string) error {
+		if err := validateProgressFormat(value); err != nil {
+			return err
+		}
+		config.ProgressFormat = value
+		config.Progress = true
+		return nil
+	})
+	flag.BoolVar(&config.Stats, "stats", false, "Validate every line and print line statistics")
+	flag.IntVar(&config.MaxLineLength, "max-line-length", 64<<10, "Longer lines are malformed and skipped unparsed, 0 - no limit")
+	flag.IntVar(&config.MaxExamples, "max-examples", 20, "Keep the first N malformed lines for -stats, 0 - none")
+	flag.BoolVar(&config.Families, "families", false, "Print how many lines were IPv4, IPv6 and unparseable")
+	flag.Float64Var(&config.WarnThreshold, "warn-threshold", -1, "Warn when malformed/total lines rate exceeds this fraction (e.g. 0.01)")
+	flag.BoolVar(&config.FailOnWarn, "fail-on-warn", false, "Exit with code 4 when -warn-threshold is exceeded")
+	flag.BoolVar(&config.StrictErrexit, "strict-errexit", false, "Abort on the first malformed line, report its number and content, exit with code 5")
+	flag.BoolVar(&config.Resolve, "resolve", false, "Resolve lines that look like hostnames and count all their IPv4 addresses (slow, uses DNS)")
+	flag.DurationVar(&config.ResolveTimeout, "resolve-timeout", 5*time.Second, "Timeout of one -resolve lookup")
+	flag.StringVar(&config.RejectFile, "reject-file", "", "Write every malformed line with its line number to FILE")
+	flag.BoolVar(&config.IPv6, "ipv6", false, "Also count distinct IPv6 hosts and /64 networks, IPv4-mapped addresses count as IPv4")
+	flag.BoolVar(&config.Combined, "combined", false, "Count IPv4 and IPv6 together and report one distinct total, IPv4-mapped addresses count once (implies -ipv6)")
+	flag.IntVar(&config.Top, "top", 0, "Report N most frequent addresses")
+	flag.IntVar(&config.WithLocations, "with-locations", 0, "Keep up to K line numbers of every -top address")
+	flag.IntVar(&config.HeavyHitters, "heavy-hitters", 0, "Report approximate K most frequent addresses in fixed memory (Space-Saving)")
+	flag.IntVar(&config.LineBase, "line-base", 1, "Number of the first line in reported line numbers: 0 or 1")
+	flag.BoolVar(&config.List, "list", false, "Print unique addresses in ascending order (summary goes to stderr)")
+	flag.BoolVar(&config.ListByFrequency, "list-by-frequency", false, "Print \"count address\" for every unique address, most frequent first (with -top N only the first N, summary goes to stderr)")
+	config.ListFormat = LIST_FORMAT_DOTTED
+	flag.Func("list-format", "Format for -list: dotted, int or hex (default dotted)", func(value string) error {
+		if err := validateListFormat(value); err != nil {
+			return err
+		}
+		config.ListFormat = value
+		return nil
+	})
+	flag.BoolVar(&config.CountUniquePorts, "count-unique-ports", false, "Count distinct ip:port endpoints, with distinct addresses and ports")
+	flag.BoolVar(&config.Pairs, "pairs", false, "Count distinct (src, dst) pairs from \"srcip dstip\" lines")
+	config.PairColumns = [2]int{1, 2}
+	flag.Func("pair-cols", "1-based whitespace separated columns of src and dst for -pairs (default 1,2)", func(value string) error {
+		columns, err := parsePairColumns(value)
+		if err != nil {
+			return err
+		}
+		config.PairColumns = columns
+		return nil
+	})
+	flag.BoolVar(&config.Sorted, "sorted", false, "Input is sorted: count by comparing neighbour addresses, without the bitmap")
+	flag.BoolVar(&config.VerifySorted, "verify-sorted", false, "With -sorted, fail on input that isn't sorted")
+	flag.StringVar(&config.Save, "save", "", "Save the resulting bitmap to FILE (512 MB)")
+	flag.StringVar(&config.CompactSave, "compact-save", "", "Save the resulting bitmap to FILE in the compact format (only non-empty segments)")
+	flag.StringVar(&config.AppendSave, "append-save", "", "OR the resulting bitmap into saved FILE (created if missing) and report new and cumulative uniques")
+	flag.StringVar(&config.NewVsSaved, "count-new-vs-saved", "", "Count only addresses missing from saved bitmap FILE, cheaper than -baseline when only the number is needed")
+	flag.StringVar(&config.Baseline, "baseline", "", "Saved bitmap to compare with: only addresses missing from it are reported as new and listed")
+	flag.StringVar(&config.DiffSave, "diff-save", "", "Save the new addresses (result minus -baseline) as a bitmap to FILE")
+	flag.BoolVar(&config.Churn, "churn", false, "Arguments are two saved bitmaps, yesterday and today: report added, removed, retained and Jaccard similarity")
+	flag.BoolVar(&config.MergeOnly, "merge-only", false, "Arguments are saved bitmaps: union them and count, no text parsing")
+	flag.IntVar(&config.Window, "window", 0, "Arguments are files in time order: report distinct addresses over the last N files after each one")
+	flag.BoolVar(&config.Repl, "repl", false, "After counting, answer queries (count, contains, histogram, range) from the bitmap")
+	flag.StringVar(&config.HistogramOut, "histogram-out", "", "Write unique addresses per first octet to FILE as CSV")
+	flag.BoolVar(&config.EmptyShards, "print-empty-shards", false, "List first octets (/8 blocks) without any address")
+	flag.BoolVar(&config.Fingerprint, "fingerprint", false, "Print a SHA-256 of the unique set, equal for runs with the same distinct addresses")
+	flag.BoolVar(&config.HistogramAll, "histogram-all", false, "Include octets without addresses in -histogram-out")
+	flag.StringVar(&config.Heatmap, "heatmap", "", "Write unique addresses per /16 as a 256x256 matrix to FILE, CSV or PNG by extension")
+	flag.StringVar(&config.Bloom, "bloom", "", "Save unique addresses as a Bloom filter to FILE")
+	flag.Float64Var(&config.BloomFP, "bloom-fp", 0.01, "False positive rate of the -bloom filter")
+	flag.StringVar(&config.SplitOutput, "split-output", "", "Write unique addresses into DIR/<first octet>.txt")
+	flag.BoolVar(&config.SplitOutputEmpty, "split-output-empty", false, "Create files for first octets without addresses too")
+	flag.BoolVar(&config.DedupSorted, "dedup-sorted", false, "Sorted sort -u of address lines: canonical unique addresses in ascending order, not the original lines (implies -canonical)")
+	flag.BoolVar(&config.Canonical, "canonical", false, "Validate every line and list unique addresses in canonical dotted form (implies -list)")
+	flag.StringVar(&config.ConfigFile, "config", "", "JSON file of default flag values ({\"workers\": 4}), overridden by IPV4_UNIQUE_* variables and flags")
+}
+
+// Shorthand flags set the flags they stand for
+func applyImpliedFlags() {
+	// -dedup-sorted is -canonical under its sort -u name
+	if config.DedupSorted {
+		config.Canonical = true
+	}
+	// -canonical is the validated -list, spelled out
+	if config.Canonical {
+		config.List = true
+	}
+	if config.ListBinary {
+		config.List = true
+		config.ListFormat = LIST_FORMAT_BINARY_BE
+		if config.LittleEndian {
+			config.ListFormat = LIST_FORMAT_BINARY_LE
+		}
+	}
+	if config.Combined {
+		config.IPv6 = true
+	}
+}
+
+// Validating path is slower, so it's used only when something needs line stats
+// Every file goes into a staging bitmap of its own first
+func (c *Config) stagesFiles() bool {
+	return c.FileTimeout > 0 || c.PerFileDups
+}
+
+func (c *Config) needsValidation() bool {
+	return c.Stats || c.Canonical || c.Families || c.WarnThreshold >= 0 || c.Column > 0 || c.GroupByColumn > 0 || c.StrictErrexit || c.Top > 0 || c.ListByFrequency || c.IPv6 || c.RejectFile != "" || c.Resolve || c.JSONFull
+}
+
+// Outputs built from the dense bitmap after counting
+func (c *Config) usesBitmap() bool {
+	return c.List || c.SplitOutput != "" || c.Save != "" || c.CompactSave != "" || c.AppendSave != "" || c.Baseline != "" || c.Bloom != "" || c.Repl || c.HistogramOut != "" || c.EmptyShards || c.Fingerprint || c.Heatmap != "" || c.JSONFull
+}
+
+// Global line numbers need one more (parallel) pass counting newlines before chunking
+func (c *Config) needsLineNumbers() bool {
+	return c.StrictErrexit || c.WithLocations > 0 || c.RejectFile != "" || c.keepsExamples()
+}
+
+// Longest line worth parsing, lines of garbage without '\n' are skipped whole
+func (c *Config) lineLengthLimit() int {
+	if c.MaxLineLength == 0 {
+		return math.MaxInt
+	}
+	return c.MaxLineLength
+}
+
+// Malformed line examples are part of -stats only
+func (c *Config) keepsExamples() bool {
+	return c.Stats && c.MaxExamples > 0
+}
+
+// Checks for flag combinations that can't work together
+func validateConfig() error {
+	dense := config.Backend == BACKEND_DENSE
+
+	if !dense && (config.usesBitmap() || config.Pairs || config.CountUniquePorts || config.MergeOnly || config.Churn) {
+		return errors.New("-list, -split-output, -pairs, -count-unique-ports, -save, -compact-save, -append-save, -baseline, -merge-only, -bloom, -repl, -histogram-out, -heatmap, -print-empty-shards, -fingerprint and -json-full need the dense backend")
+	}
+	if config.BloomFP <= 0 || config.BloomFP >= 1 {
+		return errors.New("-bloom-fp must be between 0 and 1")
+	}
+	if !dense && config.Progress {
+		return errors.New("-progress needs the dense backend")
+	}
+	if config.Workers < 0 {
+		return errors.New("-workers must be positive")
+	}
+	if config.MergeWorkers < 0 {
+		return errors.New("-merge-workers must be positive")
+	}
+	if config.JSONFull && (config.JSON || config.Template != nil || config.List || config.Repl || config.Pairs || config.CountUniquePorts ||
+		config.Incremental || config.MeasureRuns > 0 || config.Window > 0 || config.MergeOnly) {
+		return errors.New("-json-full is its own output, it can't be combined with other outputs or counting modes")
+	}
+	if config.JSON && config.Template != nil {
+		return errors.New("-json and -template can't be combined")
+	}
+	if config.ParallelCountThreshold < 0 {
+		return errors.New("-parallel-count-threshold can't be negative")
+	}
+	if config.HeadBytes < 0 {
+		return errors.New("-head-bytes must be positive")
+	}
+	if config.ParallelFiles < 1 {
+		return errors.New("-parallel-files must be at least 1")
+	}
+	if config.Pin && config.ParallelFiles > 1 {
+		return errors.New("-pin numbers workers per pool, the pools of -parallel-files would all pin to the same first CPUs")
+	}
+	if config.Incremental && (config.ParallelFiles > 1 || config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts || config.Sorted || config.Listen != "") {
+		return errors.New("-incremental counts files one by one, it can't be combined with -parallel-files or other counting modes")
+	}
+	if config.Single && (config.Workers > 1 || config.MergeWorkers > 1 || config.ParallelFiles > 1 || config.Listen != "" || config.Progress) {
+		return errors.New("-single runs without any concurrency, it can't be combined with -workers, -parallel-files, -listen or -progress")
+	}
+	if config.Prefix < -1 || config.Prefix > 255 {
+		return errors.New("-prefix must be 0-255")
+	}
+	if config.GroupByColumn < 0 {
+		return errors.New("-group-by-col is 1-based")
+	}
+	if config.GroupByColumn > 0 && (config.Column == 0 || config.GroupByColumn == config.Column) {
+		return errors.New("-group-by-col needs -col for the address, in another column")
+	}
+	if config.GroupByColumn > 0 && (config.Allow != "" || config.Block != "" || config.Mask < 32 || config.NewVsSaved != "") {
+		return errors.New("-group-by-col can't be combined with -allow, -block, -mask and -count-new-vs-saved")
+	}
+	if config.Column < 0 {
+		return errors.New("-col is 1-based")
+	}
+	if config.Top < 0 || config.WithLocations < 0 || config.HeavyHitters < 0 {
+		return errors.New("-top, -with-locations and -heavy-hitters must be positive")
+	}
+	if config.LineBase != 0 && config.LineBase != 1 {
+		return errors.New("-line-base must be 0 or 1")
+	}
+	if config.ResolveTimeout <= 0 {
+		return errors.New("-resolve-timeout must be positive")
+	}
+	if config.MaxLineLength < 0 {
+		return errors.New("-max-line-length must be positive")
+	}
+	if config.MaxExamples < 0 {
+		return errors.New("-max-examples must be positive")
+	}
+	if config.ListByFrequency && (config.List || config.JSONFull || config.Mask < 32) {
+		return errors.New("-list-by-frequency can't be combined with -list, -json-full and -mask")
+	}
+	if config.WithLocations > 0 && config.Top == 0 {
+		return errors.New("-with-locations needs -top")
+	}
+	if config.Window < 0 {
+		return errors.New("-window must be positive")
+	}
+	if config.Window > 0 && (config.MergeOnly || config.Pairs || config.needsValidation() || !dense) {
+		return errors.New("-window works only with plain counting on the dense backend")
+	}
+	if config.VerifyChecksum && (config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.EstimateRun || config.FD >= 0) {
+		return errors.New("-verify-checksum can't be combined with other modes")
+	}
+	if config.FD >= 0 && (config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts || config.Sorted || config.Listen != "" ||
+		config.StreamWindow > 0 || config.MeasureRuns > 0 || config.RawBinary || config.EstimateRun) {
+		return errors.New("-fd works only with plain and validated counting")
+	}
+	if config.Churn && (flag.NArg() != 2 || config.MergeOnly || config.Window > 0 || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.StreamWindow > 0 || config.Incremental || config.RawBinary || config.MeasureRuns > 0 || config.FD >= 0 ||
+		config.needsValidation() || config.Baseline != "" || config.NewVsSaved != "") {
+		return errors.New("-churn takes exactly two saved bitmaps and no other counting mode")
+	}
+	if config.Mask < 32 && (config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.MultiPerLine || config.Top > 0) {
+		return errors.New("-mask works only with plain and validated counting, without -top")
+	}
+	if config.Deadline < 0 {
+		return errors.New("-deadline must be positive")
+	}
+	if config.Deadline > 0 && (config.Sorted || config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.Window > 0 ||
+		config.MergeOnly || config.Churn) {
+		return errors.New("-deadline works only with counting of text inputs")
+	}
+	if config.FlushInterval < 0 {
+		return errors.New("-flush-interval must be positive")
+	}
+	if config.FlushInterval > 0 && config.Listen == "" && !config.Follow || config.FlushInterval == 0 && !config.Follow && (config.FlushFile != "" || config.FlushExact) {
+		return errors.New("-flush-interval works only with -listen and -follow, -flush-file and -flush-exact need -flush-interval")
+	}
+	if readsStdin() && (config.Repl || config.StreamWindow > 0 || config.EstimateRun || config.Window > 0 || config.MergeOnly || config.Churn || config.Sorted) {
+		return errors.New("stdin input (\"-\") can't be combined with -repl, -stream-window, -estimate-run, -window, -merge-only, -churn and -sorted")
+	}
+	if stdinInputs() > 1 {
+		return errors.New("stdin (\"-\" or -fd 0) can be read only once")
+	}
+	if config.From0 != "" && (config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.RawBinary || config.EstimateRun || config.VerifyChecksum) {
+		return errors.New("-from0 works only with plain and validated counting")
+	}
+	if config.ParseOnly && (config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.RawBinary || config.EstimateRun || config.VerifyChecksum ||
+		config.MultiPerLine || config.Prefix >= 0 || config.Incremental || config.needsValidation() || config.usesBitmap() || config.CommitLog != "" ||
+		config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Mask < 32 || config.NewVsSaved != "" || config.stagesFiles()) {
+		return errors.New("-parse-only measures the plain parser alone, without other modes, filters, statistics and outputs")
+	}
+	if config.CommitInterval <= 0 {
+		return errors.New("-commit-interval must be positive")
+	}
+	if config.CommitLog != "" && (!dense || config.Sorted || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.Window > 0 ||
+		config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.RawBinary || config.stagesFiles() ||
+		config.Progress || config.Single || config.Prefix >= 0) {
+		return errors.New("-commit-log works only with plain and validated counting and -listen, on the dense backend")
+	}
+	if config.CommitLog != "" && config.FlushInterval > 0 && !config.FlushExact {
+		return errors.New("-commit-log with -flush-interval needs -flush-exact")
+	}
+	if config.FileTimeout < 0 {
+		return errors.New("-file-timeout must be positive")
+	}
+	if config.stagesFiles() && (!dense || config.Sorted || config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 ||
+		config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs || config.CountUniquePorts || config.RawBinary) {
+		return errors.New("-file-timeout and -per-file-dups work only with counting of text inputs on the dense backend")
+	}
+	if config.StdoutBuffered && (config.Listen != "" || config.Follow || config.StreamWindow > 0 || config.Repl) {
+		return errors.New("-stdout-buffered would hold back live output of -listen, -follow, -stream-window and -repl")
+	}
+	if config.Listen != "" && (flag.NArg() > 0 || !dense || config.Window > 0 || config.MergeOnly || config.Pairs || config.Sorted ||
+		config.needsValidation() || config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Progress) {
+		return errors.New("-listen takes no files and counts plain addresses into the dense bitmap only")
+	}
+	if config.Follow && (flag.NArg() != 1 || config.From0 != "" || config.FD >= 0 || readsStdin() || isURL(flag.Arg(0)) || isTarArchive(flag.Arg(0)) ||
+		!dense || config.Listen != "" || config.StreamWindow > 0 || config.Window > 0 || config.MergeOnly || config.Churn || config.Pairs ||
+		config.CountUniquePorts || config.Sorted || config.MeasureRuns > 0 || config.RawBinary || config.Incremental || config.needsValidation() ||
+		config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Progress || config.stagesFiles() || config.Deadline > 0) {
+		return errors.New("-follow takes one local file and counts plain addresses into the dense bitmap only")
+	}
+	if config.StreamWindow < 0 || config.StreamInterval <= 0 {
+		return errors.New("-stream-window and -print-interval must be positive")
+	}
+	if config.StreamWindow > 0 && config.StreamWindow < time.Second {
+		return errors.New("-stream-window has 1 second resolution")
+	}
+	if config.TimestampColumn < 0 || config.TimestampColumn > 0 && config.StreamWindow == 0 {
+		return errors.New("-ts-col needs -stream-window")
+	}
+	if config.StreamWindow > 0 && (flag.NArg() > 0 || config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts ||
+		config.Sorted || config.Listen != "" || config.Incremental || config.RawBinary || config.MeasureRuns > 0 || config.MultiPerLine ||
+		config.usesBitmap() || config.Debug || config.Stats || config.Families || config.WarnThreshold >= 0 || config.StrictErrexit ||
+		config.Top > 0 || config.IPv6 || config.RejectFile != "" || config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Progress) {
+		return errors.New("-stream-window reads stdin only and supports just -col, -field-sep and -ts-col")
+	}
+	if config.NewVsSaved != "" && (config.Baseline != "" || config.AppendSave != "" || config.Window > 0 || config.MergeOnly || config.Pairs ||
+		config.CountUniquePorts || config.Sorted || config.Listen != "" || config.StreamWindow > 0 || config.MeasureRuns > 0 || config.MultiPerLine) {
+		return errors.New("-count-new-vs-saved works only with plain and validated counting, and not with -baseline or -append-save")
+	}
+	if config.DiffSave != "" && config.Baseline == "" {
+		return errors.New("-diff-save needs -baseline")
+	}
+	if config.WarmupRuns < 0 || config.MeasureRuns < 0 {
+		return errors.New("-warmup-runs and -measure-runs must be positive")
+	}
+	if config.WarmupRuns > 0 && config.MeasureRuns == 0 {
+		return errors.New("-warmup-runs needs -measure-runs")
+	}
+	if config.MeasureRuns > 0 && (!dense || config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.Incremental || config.RawBinary || config.needsValidation() || config.Progress || config.HeavyHitters > 0 ||
+		config.Allow != "" || config.Block != "") {
+		return errors.New("benchmark mode measures plain counting on the dense backend only")
+	}
+	if config.MultiPerLine && (config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts || config.Sorted ||
+		config.Listen != "" || config.RawBinary || config.needsValidation() || config.Prefix >= 0 || config.Single) {
+		return errors.New("-multi-per-line can't be combined with other counting modes, -prefix or line statistics")
+	}
+	if config.LittleEndian && !config.RawBinary && !config.ListBinary {
+		return errors.New("-little-endian needs -raw-binary or -list-binary")
+	}
+	if config.RawBinary && (config.Window > 0 || config.MergeOnly || config.Pairs || config.CountUniquePorts || config.Sorted || config.Listen != "" ||
+		config.Incremental || config.needsValidation() || config.HeadBytes > 0 || config.SkipHeader > 0 || config.Prefix >= 0) {
+		return errors.New("-raw-binary reads plain address records, text options and other counting modes don't apply")
+	}
+	for _, filename := range flag.Args() {
+		if config.RawBinary && (isURL(filename) || isTarArchive(filename)) {
+			return errors.New("-raw-binary works with local files only")
+		}
+	}
+	if config.Canonical && config.ListFormat != LIST_FORMAT_DOTTED {
+		return errors.New("-canonical and -dedup-sorted list dotted addresses, they can't be combined with -list-format or -list-binary")
+	}
+	if config.Sorted && isTarArchive(flag.Arg(0)) {
+		return errors.New("-sorted can't count tar archives, entries aren't one sorted stream")
+	}
+	if config.VerifySorted && !config.Sorted {
+		return errors.New("-verify-sorted needs -sorted")
+	}
+	if config.Sorted && (flag.NArg() > 1 || config.Window > 0 || config.MergeOnly || config.Pairs || config.needsValidation() ||
+		config.Prefix >= 0 || config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Progress || config.usesBitmap()) {
+		return errors.New("-sorted counts a single file without any bitmap, it can't be combined with filters, statistics or bitmap outputs")
+	}
+	if config.CountUniquePorts && (config.Pairs || config.Window > 0 || config.MergeOnly || config.Sorted || config.Listen != "" ||
+		config.needsValidation() || config.Prefix >= 0 || config.Allow != "" || config.Block != "" || config.HeavyHitters > 0 || config.Progress) {
+		return errors.New("-count-unique-ports is a counting mode of its own, it can't be combined with other modes, filters or line statistics")
+	}
+	if config.MergeOnly && (config.Pairs || config.needsValidation()) {
+		return errors.New("-merge-only doesn't parse text, it can't be combined with -pairs or line statistics")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+// Live sink for addresses coming not from a file (packet capture, sockets, etc).
+// Add is safe to call from many goroutines at a high rate, Count can be called at any time
+type ConcurrentCounter struct {
+	bitmap *Bitmap
+}
+
+func NewConcurrentCounter() *ConcurrentCounter {
+	return &ConcurrentCounter{bitmap: &Bitmap{}}
+}
+
+// ip is in host order: 192.168.1.1 -> 0xC0A80101
+func (c *ConcurrentCounter) Add(ip uint32) {
+	c.bitmap.Add(ip)
+}
+
+// Full popcount over 512 MB - call it periodically, not per packet
+func (c *ConcurrentCounter) Count() uint64 {
+	return c.bitmap.Count()
+}
+
+// Adds addresses from channel until it's closed
+func (c *ConcurrentCounter) Consume(ips <-chan uint32) {
+	for ip := range ips {
+		c.Add(ip)
+	}
+}
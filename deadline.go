@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const EXIT_DEADLINE = 6
+
+// Workers look at the deadline between pieces of this size, a bit over a millisecond of work
+const DEADLINE_PIECE_BYTES = 1 << 20
+
+// Set once -deadline has passed. Nothing is interrupted mid-piece: pieces in flight finish,
+// no new ones start, every file is unmapped as usual and the partial count is counted as usual
+var deadlineExpired atomic.Bool
+
+func startDeadline(d time.Duration) {
+	time.AfterFunc(d, func() {
+		deadlineExpired.Store(true)
+	})
+}
+
+func deadlineChunks(process func(data []byte, chunk task)) func(data []byte, chunk task) {
+	return func(data []byte, chunk task) {
+		forEachPiece(data, chunk, DEADLINE_PIECE_BYTES, func(piece task) bool {
+			if deadlineExpired.Load() {
+				return false
+			}
+			process(data, piece)
+			return true
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math/bits"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Offsets must split data into whole lines: every line belongs to exactly one chunk
+func verifyChunkOffsets(data []byte, offsets []int) {
+	if offsets[0] != 0 {
+		panic(fmt.Sprintf("chunk offsets: first offset is %d, expected 0", offsets[0]))
+	}
+	if offsets[len(offsets)-1] != len(data) {
+		panic(fmt.Sprintf("chunk offsets: last offset is %d, expected %d", offsets[len(offsets)-1], len(data)))
+	}
+
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			panic(fmt.Sprintf("chunk offsets: offset %d (%d) is less than previous (%d)", i, offsets[i], offsets[i-1]))
+		}
+
+		// Chunk has to start right after '\n', otherwise a line is split between two workers
+		if i < len(offsets)-1 && offsets[i] > 0 && offsets[i] < len(data) && data[offsets[i]-1] != '\n' {
+			panic(fmt.Sprintf("chunk offsets: offset %d (%d) is not at a line start", i, offsets[i]))
+		}
+	}
+}
+
+const SEGMENT_BITS = BITMAP_SEGMENT_SIZE * 64
+
+// Popcount cross-check: set and unset bits are counted independently
+type BitmapDebugStats struct {
+	SetBits     uint64 `json:"set_bits"`
+	UnsetBits   uint64 `json:"unset_bits"`
+	EmptyShards int    `json:"empty_shards"`
+	FullShards  int    `json:"full_shards"`
+}
+
+func getBitmapDebugStats(bitmap *Bitmap) BitmapDebugStats {
+	var set, unset [OCTET_MAX_VALUE]uint64
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			set[i] = countSegmentBits(bitmap, i)
+			for _, word := range &bitmap.segments[i] {
+				unset[i] += uint64(bits.OnesCount64(^word))
+			}
+		}
+	})
+
+	stats := BitmapDebugStats{}
+	for i := range set {
+		if set[i]+unset[i] != SEGMENT_BITS {
+			panic(fmt.Sprintf("bitmap debug: segment %d has %d set + %d unset bits, expected %d", i, set[i], unset[i], SEGMENT_BITS))
+		}
+
+		stats.SetBits += set[i]
+		stats.UnsetBits += unset[i]
+		switch set[i] {
+		case 0:
+			stats.EmptyShards++
+		case SEGMENT_BITS:
+			stats.FullShards++
+		}
+	}
+	return stats
+}
+
+// Bitmap stats have to agree with the count we are about to report
+func verifyBitmapDebugStats(stats BitmapDebugStats, count uint64) {
+	if stats.SetBits != count {
+		panic(fmt.Sprintf("bitmap debug: %d set bits, but counted %d", stats.SetBits, count))
+	}
+}
+
+// Time and size of one chunk, to see whether the equal byte split gives equal work
+type ChunkProfile struct {
+	File    string        `json:"file"`
+	Chunk   int           `json:"chunk"`
+	Start   int           `json:"start"` // byte range within the block for streamed inputs
+	End     int           `json:"end"`
+	Lines   int           `json:"lines"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+var chunkProfiles struct {
+	sync.Mutex
+	list []ChunkProfile
+}
+
+// Wraps process with one time.Now at the start and the end of every chunk.
+// Lines are counted after the clock is stopped, so they don't skew the timing
+func profileChunks(filename string, process func(data []byte, chunk task)) func(data []byte, chunk task) {
+	return func(data []byte, chunk task) {
+		startTime := time.Now()
+		process(data, chunk)
+		elapsed := time.Since(startTime)
+
+		profile := ChunkProfile{
+			File:    filename,
+			Chunk:   chunk.index,
+			Start:   chunk.start,
+			End:     chunk.end,
+			Lines:   bytes.Count(data[chunk.start:chunk.end], []byte{'\n'}),
+			Elapsed: elapsed,
+		}
+
+		chunkProfiles.Lock()
+		chunkProfiles.list = append(chunkProfiles.list, profile)
+		chunkProfiles.Unlock()
+	}
+}
+
+func getChunkProfiles() []ChunkProfile {
+	chunkProfiles.Lock()
+	defer chunkProfiles.Unlock()
+
+	profiles := slices.Clone(chunkProfiles.list)
+	slices.SortFunc(profiles, func(a, b ChunkProfile) int {
+		if c := cmp.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Chunk, b.Chunk)
+	})
+	return profiles
+}
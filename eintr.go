@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// A signal (profilers, timers, SIGUSR1 of -listen) can interrupt mmap/munmap with EINTR,
+// which is not a failure, just a reason to try again
+const EINTR_RETRIES = 16
+
+// Swappable for fault injection
+var mmapSyscall = syscall.Mmap
+var munmapSyscall = syscall.Munmap
+
+// Calls fn until it returns anything but EINTR, at most EINTR_RETRIES times.
+// Reads and writes of os.File don't need this, the runtime already retries them
+func retryEINTR(name string, fn func() error) error {
+	var err error
+	for range EINTR_RETRIES {
+		if err = fn(); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: still interrupted after %d retries: %w", name, EINTR_RETRIES, err)
+}
+
+func mmapRetry(fd int, offset int64, length, prot, flags int) ([]byte, error) {
+	var data []byte
+	err := retryEINTR("mmap", func() error {
+		var err error
+		data, err = mmapSyscall(fd, offset, length, prot, flags)
+		return err
+	})
+	return data, err
+}
+
+func munmapRetry(data []byte) error {
+	return retryEINTR("munmap", func() error {
+		return munmapSyscall(data)
+	})
+}
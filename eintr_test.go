@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// Fails the next n mmap/munmap calls with EINTR, then lets them through
+func interruptSyscalls(t *testing.T, n int) *int {
+	calls := 0
+	mmap, munmap := mmapSyscall, munmapSyscall
+	t.Cleanup(func() { mmapSyscall, munmapSyscall = mmap, munmap })
+
+	mmapSyscall = func(fd int, offset int64, length, prot, flags int) ([]byte, error) {
+		if calls++; calls <= n {
+			return nil, syscall.EINTR
+		}
+		return mmap(fd, offset, length, prot, flags)
+	}
+	munmapSyscall = func(data []byte) error {
+		if calls++; calls <= n {
+			return syscall.EINTR
+		}
+		return munmap(data)
+	}
+	return &calls
+}
+
+func TestMmapRetriesEINTR(t *testing.T) {
+	calls := interruptSyscalls(t, 3)
+	data, err := mmapRetry(-1, 0, 4096, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil || len(data) != 4096 || *calls != 4 {
+		t.Fatalf("mmap: got %d bytes, %v after %d calls", len(data), err, *calls)
+	}
+
+	*calls = 0
+	if err := munmapRetry(data); err != nil || *calls != 4 {
+		t.Errorf("munmap: got %v after %d calls", err, *calls)
+	}
+}
+
+func TestMmapGivesUpOnEINTR(t *testing.T) {
+	calls := interruptSyscalls(t, EINTR_RETRIES)
+	_, err := mmapRetry(-1, 0, 4096, syscall.PROT_READ, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if !errors.Is(err, syscall.EINTR) || *calls != EINTR_RETRIES {
+		t.Errorf("got %v after %d calls, want EINTR after %d", err, *calls, EINTR_RETRIES)
+	}
+}
+
+// Anything but EINTR is returned right away
+func TestRetryEINTROtherError(t *testing.T) {
+	calls := 0
+	err := retryEINTR("test", func() error {
+		calls++
+		return syscall.ENOMEM
+	})
+	if err != syscall.ENOMEM || calls != 1 {
+		t.Errorf("got %v after %d calls, want ENOMEM after 1", err, calls)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// A log that hasn't rotated yet: nothing to count, but not an error
+func TestEmptyInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		checked bool
+	}{
+		{"empty", "", false},
+		{"blank lines", "\n\n\n", false},
+		{"whitespace", " \t\n\r\n  \n", false},
+		{"empty, validated", "", true},
+		{"whitespace, validated", " \t\n\r\n  \n", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t)
+			filename := writeInput(t, "empty.txt", test.content)
+			b := newTestBitmap(t)
+
+			var count uint64
+			if test.checked {
+				config.Stats = true
+				var stats *LineStats
+				var err error
+				count, stats, err = countUniqueIPsChecked([]string{filename}, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stats.Lines != 0 || stats.Malformed != 0 {
+					t.Errorf("lines %d, malformed %d, want none", stats.Lines, stats.Malformed)
+				}
+			} else {
+				count = countUniqueIPs([]string{filename}, b)
+			}
+			if count != 0 {
+				t.Errorf("count = %d, want 0", count)
+			}
+		})
+	}
+}
+
+// Empty files between others don't change the union
+func TestEmptyFileAmongOthers(t *testing.T) {
+	resetConfig(t)
+	files := []string{
+		writeInput(t, "a.txt", "1.1.1.1\n"),
+		writeInput(t, "empty.txt", ""),
+		writeInput(t, "b.txt", "2.2.2.2\n1.1.1.1\n"),
+	}
+	if count := countUniqueIPs(files, newTestBitmap(t)); count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	ENCODING_UTF8    = "utf8"
+	ENCODING_LATIN1  = "latin1"
+	ENCODING_UTF16LE = "utf16le"
+	ENCODING_UTF16BE = "utf16be"
+)
+
+var errInvalidUTF16 = errors.New("invalid UTF-16 sequence")
+
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case ENCODING_UTF8, ENCODING_LATIN1, ENCODING_UTF16LE, ENCODING_UTF16BE:
+		return nil
+	}
+	return fmt.Errorf("unknown input encoding %q, expected utf8, latin1, utf16le or utf16be", encoding)
+}
+
+// UTF-8 and Latin-1 are ASCII compatible: digits, dots and newlines are the same bytes,
+// high bytes only make their line malformed. So only UTF-16 needs decoding (and the reader path)
+func needsDecoding(encoding string) bool {
+	return encoding == ENCODING_UTF16LE || encoding == ENCODING_UTF16BE
+}
+
+func wrapDecoder(r io.Reader, encoding string) io.Reader {
+	if !needsDecoding(encoding) {
+		return r
+	}
+	return &utf16Reader{r: bufio.NewReaderSize(r, 1<<20), bigEndian: encoding == ENCODING_UTF16BE, first: true}
+}
+
+// Decodes UTF-16 into ASCII: every non-ASCII character becomes '?', which makes its line malformed.
+// Unpaired surrogates and an odd number of bytes are errors, not something to guess around
+type utf16Reader struct {
+	r         *bufio.Reader
+	bigEndian bool
+	first     bool
+}
+
+func (u *utf16Reader) readUnit() (uint16, error) {
+	var pair [2]byte
+	n, err := io.ReadFull(u.r, pair[:])
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n == 1) {
+		return 0, fmt.Errorf("%w: odd number of bytes", errInvalidUTF16)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if u.bigEndian {
+		return uint16(pair[0])<<8 | uint16(pair[1]), nil
+	}
+	return uint16(pair[1])<<8 | uint16(pair[0]), nil
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		unit, err := u.readUnit()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if u.first {
+			u.first = false
+			if unit == 0xFEFF {
+				continue
+			}
+		}
+
+		switch {
+		case unit < 0x80:
+			p[n] = byte(unit)
+		case unit >= 0xD800 && unit < 0xDC00:
+			low, err := u.readUnit()
+			if err != nil || low < 0xDC00 || low >= 0xE000 {
+				return n, fmt.Errorf("%w: unpaired surrogate", errInvalidUTF16)
+			}
+			p[n] = '?'
+		case unit >= 0xDC00 && unit < 0xE000:
+			return n, fmt.Errorf("%w: unpaired surrogate", errInvalidUTF16)
+		default:
+			p[n] = '?'
+		}
+		n++
+	}
+	return n, nil
+}
+
+func processDecodedFile(filename string, process func(data []byte, chunk task)) {
+	file, err := os.Open(filename)
+	if err != nil {
+		fatal(err)
+	}
+	defer file.Close()
+
+	if err := processReader(wrapDecoder(file, config.InputEncoding), process); err != nil {
+		fatal(fmt.Errorf("%s: %w", filename, err))
+	}
+}
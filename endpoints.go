@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"math/bits"
+	"sync/atomic"
+)
+
+// Distinct ip:port endpoints plus distinct addresses and ports on their own
+type EndpointsResult struct {
+	Endpoints uint64 `json:"endpoints"`
+	IPs       uint64 `json:"ips"`
+	Ports     uint64 `json:"ports"`
+	Malformed uint64 `json:"malformed"`
+}
+
+type endpointCounter struct {
+	endpoints *ShardedSet[uint64] // ip<<16 | port
+	ips       *Bitmap
+	ports     [1 << 16 / 64]uint64
+	malformed atomic.Uint64
+}
+
+// "1.2.3.4:443" -> address and port, the port has to be 0-65535
+func parseEndpoint(data []byte, start, end int) (uint32, uint16, bool) {
+	for start < end && isSpace(data[start]) {
+		start++
+	}
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+
+	colon := bytes.LastIndexByte(data[start:end], ':')
+	if colon == -1 {
+		return 0, 0, false
+	}
+	colon += start
+
+	ip, ok := parseIPv4Strict(data, start, colon)
+	if !ok || colon+1 == end || end-colon-1 > 5 {
+		return 0, 0, false
+	}
+
+	port := uint32(0)
+	for _, c := range data[colon+1 : end] {
+		if c < '0' || c > '9' {
+			return 0, 0, false
+		}
+		port = port*10 + uint32(c-'0')
+	}
+	if port > 65535 {
+		return 0, 0, false
+	}
+	return ip, uint16(port), true
+}
+
+func (c *endpointCounter) processChunk(data []byte, start, end int) {
+	lineStart := start
+	malformed := uint64(0)
+
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+
+		if !isBlankLine(data, lineStart, i) {
+			if ip, port, ok := parseEndpoint(data, lineStart, i); ok {
+				c.ips.Add(ip)
+				atomic.OrUint64(&c.ports[port>>6], uint64(1)<<(port&63))
+				c.endpoints.Add(uint64(ip)<<16 | uint64(port))
+			} else {
+				malformed++
+			}
+		}
+		lineStart = i + 1
+	}
+	c.malformed.Add(malformed)
+}
+
+// Uses the dense bitmap for addresses plus the endpoint set
+func countUniqueEndpoints(filenames []string) EndpointsResult {
+	counter := &endpointCounter{endpoints: NewShardedSet(shardIndex), ips: bitmap}
+	endpointSet = counter.endpoints
+
+	processFiles(filenames, func(data []byte, chunk task) {
+		counter.processChunk(data, chunk.start, chunk.end)
+	})
+
+	ports := uint64(0)
+	for _, word := range counter.ports {
+		ports += uint64(bits.OnesCount64(word))
+	}
+	return EndpointsResult{
+		Endpoints: counter.endpoints.Count(),
+		IPs:       counter.ips.Count(),
+		Ports:     ports,
+		Malformed: counter.malformed.Load(),
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+const ESTIMATE_SAMPLE_SIZE = 64 << 20
+const DENSE_BITMAP_BYTES = OCTET_MAX_VALUE * BITMAP_SEGMENT_SIZE * 8
+const SPARSE_BYTES_PER_UNIQUE = 40
+const MIN_LINE_BYTES = 8 // "0.0.0.0\n"
+
+// Prediction for -estimate-run. Throughput is measured on the beginning of the file
+type RunEstimate struct {
+	FileSize       int64
+	SampleSize     int
+	ThroughputMBps float64
+	Duration       time.Duration
+	SparseMaxBytes int64
+	Backend        string
+}
+
+func estimateRun(filename string) RunEstimate {
+	data, closeFile := getMmapDataFromFilename(filename)
+	defer closeFile()
+
+	estimate := RunEstimate{FileSize: int64(len(data)), Backend: BACKEND_DENSE}
+
+	// Sample is cut to the last full line
+	sample := data[:min(len(data), ESTIMATE_SAMPLE_SIZE)]
+	if idx := bytes.LastIndexByte(sample, '\n'); idx >= 0 {
+		sample = sample[:idx+1]
+	}
+	estimate.SampleSize = len(sample)
+
+	if len(sample) > 0 {
+		sampleBitmap, err := allocateBitmap()
+		if err != nil {
+			panic(err.Error())
+		}
+
+		startTime := time.Now()
+		offsets := getChunkOffsets(sample)
+		runWorkers(WORKERS_AMOUNT, offsetTasks(offsets, nil), func(t task) {
+			processChunkBitmap(sample, t.start, t.end, sampleBitmap)
+		})
+		elapsed := time.Since(startTime)
+
+		estimate.ThroughputMBps = float64(len(sample)) / (1 << 20) / elapsed.Seconds()
+		estimate.Duration = time.Duration(float64(elapsed) * float64(len(data)) / float64(len(sample)))
+	}
+
+	// Every line is at least 8 bytes, so that's the upper bound of uniques
+	estimate.SparseMaxBytes = estimate.FileSize / MIN_LINE_BYTES * SPARSE_BYTES_PER_UNIQUE
+	if estimate.SparseMaxBytes < DENSE_BITMAP_BYTES {
+		estimate.Backend = BACKEND_SPARSE
+	}
+	return estimate
+}
+
+func printRunEstimate(w io.Writer, e RunEstimate) {
+	fmt.Fprintf(w, "File size: %s MB\n", formatGrouped(uint64(e.FileSize>>20)))
+	fmt.Fprintf(w, "Dense bitmap: %d MB fixed\n", DENSE_BITMAP_BYTES>>20)
+	fmt.Fprintf(w, "Sparse set: up to %s MB\n", formatGrouped(uint64(e.SparseMaxBytes>>20)))
+	fmt.Fprintf(w, "Estimated time at %.0f MB/s (measured on first %d MB, %d workers): ~%s\n",
+		e.ThroughputMBps, e.SampleSize>>20, WORKERS_AMOUNT, e.Duration.Round(time.Second/10))
+	fmt.Fprintf(w, "Recommended backend: %s\n", e.Backend)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reserves the blocks of the first size bytes up front: a full disk is an ENOSPC here,
+// not a SIGBUS on a write through the mapping later
+func preallocate(file *os.File, size int64) error {
+	return retryEINTR("fallocate", func() error {
+		return syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	})
+}
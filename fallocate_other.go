@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// No fallocate: without reserved blocks a mapped write can't report a full disk, so saves are buffered
+func preallocate(file *os.File, size int64) error {
+	return errors.New("fallocate is Linux only")
+}
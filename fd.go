@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// -fd N is an input named "fd:N", so it goes through processFiles like any file
+const FD_INPUT_PREFIX = "fd:"
+
+// Files from the command line, the -from0 manifest and the -fd descriptor
+func inputFiles() []string {
+	files := append(flag.Args()[:flag.NArg():flag.NArg()], manifestFiles...)
+	if config.FD < 0 {
+		return files
+	}
+	return append(files, fdInputName())
+}
+
+func fdInputName() string {
+	return FD_INPUT_PREFIX + strconv.Itoa(config.FD)
+}
+
+// Only the -fd input itself, a file really called "fd:3" is still a file
+func isFDInput(filename string) bool {
+	return config.FD >= 0 && filename == fdInputName()
+}
+
+// Inherited descriptor instead of a path (systemd fd passing, sandboxes)
+func processFD(filename string, process func(data []byte, chunk task)) {
+	file := os.NewFile(uintptr(config.FD), filename)
+	if err := processOpenFile(file, filename, process); err != nil {
+		fatal(fmt.Errorf("-fd %d: %w", config.FD, err))
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFieldQuoted(t *testing.T) {
+	tests := []struct {
+		line   string
+		column int
+		want   string
+		ok     bool
+	}{
+		{`a,10.0.0.1,b`, 2, `10.0.0.1`, true},
+		{`a,"10.0.0.1",b`, 2, `10.0.0.1`, true},
+		{`"x,y",10.0.0.1`, 2, `10.0.0.1`, true},        // separator inside quotes
+		{`"say ""hi""",10.0.0.1`, 2, `10.0.0.1`, true}, // escaped quotes
+		{`"say ""hi""",10.0.0.1`, 1, `say ""hi""`, true},
+		{`a, "10.0.0.1" ,b`, 2, `10.0.0.1`, true}, // padding around the quotes
+		{`a,"",b`, 2, ``, true},
+		{`a,,b`, 2, ``, true},
+		{`a,b,`, 3, ``, true}, // empty last field
+		{`a,b`, 3, ``, false},
+		{`a,"10.0.0.1,b`, 2, ``, false},   // unterminated
+		{`a,"10.0.0.1"x,b`, 2, ``, false}, // garbage after the closing quote
+		{`"a"x,10.0.0.1`, 2, ``, false},   // a broken row is broken for every column
+	}
+
+	comma := &FieldSeparators{',': true}
+	for _, test := range tests {
+		data := []byte(test.line)
+		start, end, ok := getField(data, 0, len(data), test.column, comma)
+		if ok != test.ok || ok && string(data[start:end]) != test.want {
+			t.Errorf("%s column %d: got %q, %v, want %q, %v", test.line, test.column, data[start:end], ok, test.want, test.ok)
+		}
+	}
+}
+
+// -col with -field-sep counts quoted addresses and reports broken rows as malformed
+func TestColumnQuotedCSV(t *testing.T) {
+	resetConfig(t)
+	config.Column = 2
+	config.FieldSep = &FieldSeparators{',': true}
+	filename := writeInput(t, "in.csv", "\"host, one\",\"10.0.0.1\",x\n\"b\",10.0.0.2\nc,\"10.0.0.3\nd,\"10.0.0.1\"\n")
+
+	count, stats, err := countUniqueIPsChecked([]string{filename}, newTestBitmap(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || stats.Malformed != 1 {
+		t.Errorf("got %d unique, %d malformed, want 2 and 1", count, stats.Malformed)
+	}
+}
+
+func TestParseFieldSeparator(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // every separator byte
+		ok    bool
+	}{
+		{",", ",", true},
+		{",;", ",;", true},
+		{"tab", "\t", true},
+		{`\t`, "\t", true},
+		{`,\t|`, "\t,|", true},
+		{"space", " ", true},
+		{"", "", false},
+		{`,"`, "", false},
+	}
+
+	for _, test := range tests {
+		seps, err := parseFieldSeparator(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v", test.value, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got strings.Builder
+		for c, sep := range seps {
+			if sep {
+				got.WriteByte(byte(c))
+			}
+		}
+		if got.String() != test.want {
+			t.Errorf("%q: got separators %q, want %q", test.value, got.String(), test.want)
+		}
+	}
+}
+
+// Any byte of the set ends a field, also right next to quotes
+func TestGetFieldSeparatorSet(t *testing.T) {
+	seps, err := parseFieldSeparator(`,;\t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte("a;b\t\"10.0.0.1\",c")
+	want := []string{"a", "b", "10.0.0.1", "c"}
+	for i, field := range want {
+		start, end, ok := getField(line, 0, len(line), i+1, seps)
+		if !ok || string(line[start:end]) != field {
+			t.Errorf("column %d: got %q, %v, want %q", i+1, line[start:end], ok, field)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"sync/atomic"
+)
+
+// Allowlist/blocklist of individual addresses, both are dense bitmaps (512 MB each)
+type Filter struct {
+	allow *Bitmap
+	block *Bitmap
+
+	notAllowed atomic.Uint64
+	blocked    atomic.Uint64
+}
+
+type FilterStats struct {
+	NotAllowed uint64 `json:"not_allowed"`
+	Blocked    uint64 `json:"blocked"`
+}
+
+var filter *Filter
+
+func newFilter(allowFile, blockFile string) *Filter {
+	f := &Filter{}
+	if allowFile != "" {
+		f.allow = loadAddressList(allowFile)
+	}
+	if blockFile != "" {
+		f.block = loadAddressList(blockFile)
+	}
+	return f
+}
+
+// One address per line, invalid lines are ignored
+func loadAddressList(filename string) *Bitmap {
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer file.Close()
+
+	list, err := allocateBitmap()
+	if err != nil {
+		panic(err.Error())
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if ip, ok := parseIPv4Strict(line, 0, len(line)); ok {
+			list.Add(ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err.Error())
+	}
+	return list
+}
+
+func (f *Filter) stats() *FilterStats {
+	return &FilterStats{NotAllowed: f.notAllowed.Load(), Blocked: f.blocked.Load()}
+}
+
+// Per-worker filtering in front of the real counter
+type filterCounter struct {
+	inner      Counter
+	filter     *Filter
+	notAllowed uint64
+	blocked    uint64
+}
+
+func (c *filterCounter) Add(ip uint32) {
+	if c.filter.allow != nil && !c.filter.allow.Contains(ip) {
+		c.notAllowed++
+		return
+	}
+	if c.filter.block != nil && c.filter.block.Contains(ip) {
+		c.blocked++
+		return
+	}
+	c.inner.Add(ip)
+}
+
+func (c *filterCounter) Count() uint64 {
+	return c.inner.Count()
+}
+
+func (c *filterCounter) flush() {
+	c.filter.notAllowed.Add(c.notAllowed)
+	c.filter.blocked.Add(c.blocked)
+	c.notAllowed, c.blocked = 0, 0
+}
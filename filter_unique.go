@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// Streaming dedup with a predicate: writes every line whose address is seen for the
+// first time and passes keep. Malformed lines are dropped.
+//
+// Runs in a single pass on the calling goroutine: keep is never called concurrently,
+// it's called once per distinct address (so it should be pure), and output keeps
+// the input order - the first occurrence of every address wins
+func FilterUnique(data []byte, keep func(ip uint32) bool, out io.Writer) error {
+	seen, err := allocateBitmap()
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(out, 1<<20)
+	lineStart := 0
+
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] != '\n' {
+			continue
+		}
+
+		ip, ok := parseIPv4Strict(data, lineStart, i)
+		if ok && seen.AddNew(ip) && keep(ip) {
+			writer.Write(data[lineStart:i])
+			writer.WriteByte('\n')
+		}
+		lineStart = i + 1
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// SHA-256 of the unique set. The bitmap is canonical for a set, so order and duplicates of the
+// input don't matter. Segments are hashed in parallel (little endian words, as in -save),
+// the fingerprint is SHA-256 over the 256 segment digests in /8 order
+func (b *Bitmap) Fingerprint() string {
+	var digests [OCTET_MAX_VALUE][sha256.Size]byte
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		buf := make([]byte, BITMAP_SEGMENT_SIZE*8)
+		for i := t.start; i < t.end; i++ {
+			for j, word := range &b.segments[i] {
+				binary.LittleEndian.PutUint64(buf[j*8:], word)
+			}
+			digests[i] = sha256.Sum256(buf)
+		}
+	})
+
+	hash := sha256.New()
+	for i := range digests {
+		hash.Write(digests[i][:])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How often -follow looks for appended data and rotation
+const FOLLOW_POLL_INTERVAL = 250 * time.Millisecond
+
+// Read size of -follow, appended data usually comes in much smaller pieces
+const FOLLOW_READ_SIZE = 1 << 20
+
+// Growing file like tail -F: everything already in it is counted, then appended lines are counted
+// into the live counter until SIGTERM/SIGINT. A line is counted only once its newline is there,
+// the incomplete tail waits for the next read. The path is re-stat'ed every poll: another file
+// under it (rotation by rename) is opened from the start, a file shorter than what was read
+// (truncation, copytruncate) is read again from the start. Malformed lines are ignored like in -listen
+type follower struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+
+	pending  []byte // incomplete last line
+	skipping bool   // inside a line over -max-line-length, until its newline
+	buf      []byte
+}
+
+func openFollower(path string) (*follower, error) {
+	file, info, err := openFollowed(path)
+	if err != nil {
+		return nil, err
+	}
+	return &follower{path: path, file: file, info: info, buf: make([]byte, FOLLOW_READ_SIZE)}, nil
+}
+
+func openFollowed(path string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: -follow needs a regular file", path)
+	}
+	return file, info, nil
+}
+
+// Counts everything appended since the last poll, then checks the path for rotation
+func (f *follower) poll(counter Counter) error {
+	if err := f.read(counter); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // renamed away, the new file isn't there yet
+	}
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(info, f.info) {
+		file, info, err := openFollowed(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // replaced and gone again, next poll
+		}
+		if err != nil {
+			return err
+		}
+		// The old file is read to the end, its last line just had no newline
+		if !f.skipping {
+			f.countLine(f.pending, counter)
+		}
+		f.file.Close()
+		f.file, f.info, f.offset = file, info, 0
+		f.pending, f.skipping = f.pending[:0], false
+		fmt.Fprintln(os.Stderr, "Following new", f.path)
+		return f.read(counter)
+	}
+	if info.Size() < f.offset {
+		// The rest of the incomplete line is gone with the truncation, it's dropped
+		f.offset, f.pending, f.skipping = 0, f.pending[:0], false
+		fmt.Fprintln(os.Stderr, "Truncated, following from the start:", f.path)
+		return f.read(counter)
+	}
+	return nil
+}
+
+func (f *follower) read(counter Counter) error {
+	for {
+		n, err := f.file.ReadAt(f.buf, f.offset)
+		f.consume(f.buf[:n], counter)
+		f.offset += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (f *follower) consume(data []byte, counter Counter) {
+	maxLine := config.lineLengthLimit()
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if f.skipping {
+			f.skipping = false
+		} else if len(f.pending) > 0 {
+			f.pending = append(f.pending, data[:i]...)
+			f.countLine(f.pending, counter)
+		} else {
+			f.countLine(data[:i], counter)
+		}
+		f.pending = f.pending[:0]
+		data = data[i+1:]
+	}
+
+	if f.skipping {
+		return
+	}
+	// A line without newline for this long is never going to be an address
+	if len(f.pending)+len(data) > maxLine {
+		f.pending, f.skipping = f.pending[:0], true
+		return
+	}
+	f.pending = append(f.pending, data...)
+}
+
+func (f *follower) countLine(line []byte, counter Counter) {
+	if len(line) > config.lineLengthLimit() {
+		return
+	}
+	if ip, ok := parseIPv4Strict(line, 0, len(line)); ok {
+		counter.Add(ip)
+	}
+}
+
+// -follow: the running count goes out every -flush-interval, or every -print-interval without it.
+// SIGUSR1 prints it to stderr
+func runFollow(path string, counter *ConcurrentCounter) (uint64, error) {
+	f, err := openFollower(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { f.file.Close() }() // the file changes with rotation
+
+	interval := config.FlushInterval
+	if interval == 0 {
+		interval = config.StreamInterval
+	}
+	live, stop := liveCounter(counter, interval)
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(FOLLOW_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	// Everything already in the file first, so the count starts complete
+	if err := f.poll(live); err != nil {
+		return live.Count(), err
+	}
+	fmt.Fprintln(os.Stderr, "Following", path)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.poll(live); err != nil {
+				return live.Count(), err
+			}
+		case sig := <-signals:
+			if sig == syscall.SIGUSR1 {
+				fmt.Fprintln(os.Stderr, "Unique IP addresses amount: ", formatCount(live.Count()))
+				continue
+			}
+			// What was appended up to now still counts, an unfinished line doesn't
+			err := f.read(live)
+			return live.Count(), err
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+// Formats n with thousands separators: 12345678 -> "12,345,678".
+// Allocates the string, fine for a one-off; anything printed over and over goes through appendGrouped
+func formatGrouped(n uint64) string {
+	return string(appendGrouped(nil, n))
+}
+
+// Appends n with thousands separators to dst. Digits are written into a stack buffer
+// from the end, no fmt or locale involved, so with enough capacity in dst nothing is allocated
+func appendGrouped(dst []byte, n uint64) []byte {
+	var buf [26]byte // 20 digits + 6 separators for max uint64
+	i := len(buf)
+
+	for digits := 0; ; digits++ {
+		if digits > 0 && digits%3 == 0 {
+			i--
+			buf[i] = ','
+		}
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+		if n == 0 {
+			break
+		}
+	}
+
+	return append(dst, buf[i:]...)
+}
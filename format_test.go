@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAppendGrouped(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{12345678, "12,345,678"},
+		{100000, "100,000"},
+		{math.MaxUint64, "18,446,744,073,709,551,615"},
+	}
+
+	for _, test := range tests {
+		if got := string(appendGrouped([]byte("n="), test.n)); got != "n="+test.want {
+			t.Errorf("appendGrouped(%d) = %q, want %q", test.n, got, "n="+test.want)
+		}
+		if got := formatGrouped(test.n); got != test.want {
+			t.Errorf("formatGrouped(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestAppendGroupedNoAllocs(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = appendGrouped(buf[:0], math.MaxUint64)
+	})
+	if allocs != 0 {
+		t.Errorf("appendGrouped allocates %v times per call", allocs)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// -list-by-frequency sorts the whole distinct set, past this many addresses it's worth a warning
+const RANKED_WARN_ADDRESSES = 50_000_000
+
+// Map entry, entry and the sort item, roughly
+const FREQUENCY_BYTES_PER_ADDRESS = 80
+
+// Exact occurrence count of every distinct address, optionally with a few line numbers.
+// Needs memory for the whole distinct set, unlike the bitmap
+type FrequencyMap struct {
+	shards    [SHARDS_AMOUNT]frequencyShard
+	locations int // line numbers kept per address
+}
+
+type frequencyShard struct {
+	mu      sync.Mutex
+	entries map[uint32]*frequencyEntry
+}
+
+type frequencyEntry struct {
+	count uint64
+	lines []uint64 // smallest ones, sorted - workers see lines out of order
+}
+
+type TopEntry struct {
+	Address string   `json:"address"`
+	Count   uint64   `json:"count"`
+	Lines   []uint64 `json:"lines,omitempty"`
+}
+
+var frequencies *FrequencyMap
+
+func NewFrequencyMap(locations int) *FrequencyMap {
+	f := &FrequencyMap{locations: locations}
+	for i := range f.shards {
+		f.shards[i].entries = make(map[uint32]*frequencyEntry)
+	}
+	return f
+}
+
+func (f *FrequencyMap) Add(ip uint32, line uint64) {
+	shard := &f.shards[shardIndex(uint64(ip))]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry := shard.entries[ip]
+	if entry == nil {
+		entry = &frequencyEntry{}
+		shard.entries[ip] = entry
+	}
+	entry.count++
+
+	if f.locations == 0 || (len(entry.lines) == f.locations && line >= entry.lines[len(entry.lines)-1]) {
+		return
+	}
+	if len(entry.lines) == f.locations {
+		entry.lines = entry.lines[:len(entry.lines)-1]
+	}
+	idx, _ := slices.BinarySearch(entry.lines, line)
+	entry.lines = slices.Insert(entry.lines, idx, line)
+}
+
+type rankedItem struct {
+	ip    uint32
+	entry *frequencyEntry
+}
+
+// Every distinct address, most frequent first, ties are broken by address
+func (f *FrequencyMap) ranked() []rankedItem {
+	var items []rankedItem
+	for i := range f.shards {
+		for ip, entry := range f.shards[i].entries {
+			items = append(items, rankedItem{ip, entry})
+		}
+	}
+
+	slices.SortFunc(items, func(a, b rankedItem) int {
+		if c := cmp.Compare(b.entry.count, a.entry.count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ip, b.ip)
+	})
+	return items
+}
+
+// Most frequent addresses, ties are broken by address
+func (f *FrequencyMap) Top(n int) []TopEntry {
+	items := f.ranked()
+
+	top := make([]TopEntry, 0, min(n, len(items)))
+	for _, it := range items[:min(n, len(items))] {
+		top = append(top, TopEntry{Address: string(appendIPv4(nil, it.ip)), Count: it.entry.count, Lines: it.entry.lines})
+	}
+	return top
+}
+
+// -list-by-frequency: "count address" lines, most frequent first, only the first n if n > 0
+func (f *FrequencyMap) WriteRanked(w io.Writer, n int) {
+	items := f.ranked()
+	if n > 0 {
+		items = items[:min(n, len(items))]
+	} else if len(items) > RANKED_WARN_ADDRESSES {
+		fmt.Fprintf(os.Stderr, "Warning: ranking %s addresses takes ~%d MB, -top N keeps only the first N\n",
+			formatCount(uint64(len(items))), uint64(len(items))*FREQUENCY_BYTES_PER_ADDRESS>>20)
+	}
+
+	writer := bufio.NewWriterSize(w, 1<<20)
+	var buf []byte
+	for _, it := range items {
+		buf = strconv.AppendUint(buf[:0], it.entry.count, 10)
+		buf = append(buf, ' ')
+		buf = append(appendIPv4(buf, it.ip), '\n')
+		writer.Write(buf)
+	}
+
+	if err := writer.Flush(); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (f *FrequencyMap) shardSizes() [SHARDS_AMOUNT]uint64 {
+	var sizes [SHARDS_AMOUNT]uint64
+	for i := range f.shards {
+		f.shards[i].mu.Lock()
+		sizes[i] = uint64(len(f.shards[i].entries))
+		f.shards[i].mu.Unlock()
+	}
+	return sizes
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Bumped on any incompatible change of FullSummary: renamed or removed fields, changed meaning.
+// New fields don't bump it, consumers should ignore keys they don't know
+const FULL_SUMMARY_VERSION = 1
+
+// -json-full: every metric in one object. All keys are always present, so empty input gives
+// zero counts, null min/max and a histogram of 256 zeros instead of missing keys
+type FullSummary struct {
+	Version int `json:"version"`
+
+	Unique        uint64  `json:"unique"`
+	Lines         uint64  `json:"lines"`
+	Malformed     uint64  `json:"malformed"`
+	MalformedRate float64 `json:"malformed_rate"`
+	IPv4          uint64  `json:"ipv4"`
+	IPv6          uint64  `json:"ipv6"`
+	Other         uint64  `json:"other"`
+
+	Min        *string                 `json:"min"` // null without addresses
+	Max        *string                 `json:"max"`
+	Distinct24 uint64                  `json:"distinct_24"`
+	NonEmpty8  int                     `json:"non_empty_8"`
+	Histogram  [OCTET_MAX_VALUE]uint64 `json:"histogram"` // unique per first octet, index is the octet
+
+	ElapsedNs int64  `json:"elapsed_ns"`
+	Bytes     int64  `json:"bytes"` // size of local input files, URLs and stdin aren't known upfront
+	Workers   int    `json:"workers"`
+	Backend   string `json:"backend"`
+}
+
+func getFullSummary(r Result, bitmap *Bitmap, filenames []string) FullSummary {
+	stats := bitmap.Stats()
+	summary := FullSummary{
+		Version:    FULL_SUMMARY_VERSION,
+		Unique:     r.Unique,
+		Distinct24: stats.Distinct24,
+		NonEmpty8:  stats.NonEmptyShards,
+		Histogram:  stats.PerShard,
+		ElapsedNs:  r.Elapsed.Nanoseconds(),
+		Bytes:      inputBytes(filenames),
+		Workers:    WORKERS_AMOUNT,
+		Backend:    config.Backend,
+	}
+
+	if r.Lines != nil {
+		summary.Lines = r.Lines.Lines
+		summary.Malformed = r.Lines.Malformed
+		summary.MalformedRate = r.Lines.MalformedRate
+		summary.IPv4 = r.Lines.IPv4
+		summary.IPv6 = r.Lines.IPv6
+		summary.Other = r.Lines.Other
+	}
+	if stats.Unique > 0 {
+		minIP, maxIP := string(appendIPv4(nil, stats.Min)), string(appendIPv4(nil, stats.Max))
+		summary.Min, summary.Max = &minIP, &maxIP
+	}
+	return summary
+}
+
+func inputBytes(filenames []string) int64 {
+	total := int64(0)
+	for _, filename := range filenames {
+		if isURL(filename) {
+			continue
+		}
+		if fileInfo, err := os.Stat(filename); err == nil {
+			total += fileInfo.Size()
+		}
+	}
+	return total
+}
+
+func printFullSummary(w io.Writer, summary FullSummary) {
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// -group-by-col: distinct addresses per value of another column ("tenant_id ip").
+// A dense bitmap per group would be 512 MB per tenant, so groups are sparse sets
+// (HyperLogLog with -backend hll)
+type groupCounter struct {
+	mu     sync.RWMutex
+	groups map[string]Counter
+}
+
+type GroupCount struct {
+	Group  string `json:"group"`
+	Unique uint64 `json:"unique"`
+}
+
+// Set in main with -group-by-col, nil otherwise
+var groups *groupCounter
+
+func newGroupCounter() *groupCounter {
+	return &groupCounter{groups: make(map[string]Counter)}
+}
+
+func newGroupSet() Counter {
+	if config.Backend == BACKEND_HLL {
+		return NewHyperLogLog(HLL_PRECISION, config.Seed)
+	}
+	return NewSparseSet()
+}
+
+// Lines without the key column are counted globally, just not in any group
+func (g *groupCounter) add(data []byte, start, end int, ip uint32) {
+	start, end, ok := getField(data, start, end, config.GroupByColumn, config.FieldSep)
+	if !ok {
+		return
+	}
+	key := data[start:end]
+
+	// Lookup with string(key) doesn't allocate, only a new group does
+	g.mu.RLock()
+	set, ok := g.groups[string(key)]
+	g.mu.RUnlock()
+
+	if !ok {
+		g.mu.Lock()
+		if set, ok = g.groups[string(key)]; !ok {
+			set = newGroupSet()
+			g.groups[string(key)] = set
+		}
+		g.mu.Unlock()
+	}
+	set.Add(ip)
+}
+
+// Biggest groups first, ties by name
+func (g *groupCounter) counts() []GroupCount {
+	counts := make([]GroupCount, 0, len(g.groups))
+	for group, set := range g.groups {
+		counts = append(counts, GroupCount{Group: group, Unique: set.Count()})
+	}
+	slices.SortFunc(counts, func(a, b GroupCount) int {
+		if c := cmp.Compare(b.Unique, a.Unique); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Group, b.Group)
+	})
+	return counts
+}
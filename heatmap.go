@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Unique addresses per /16: [first octet][second octet]. A /16 is 1024 consecutive words of its segment
+func getHeatmap(bitmap *Bitmap) *[OCTET_MAX_VALUE][OCTET_MAX_VALUE]uint64 {
+	heatmap := &[OCTET_MAX_VALUE][OCTET_MAX_VALUE]uint64{}
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			for j, word := range &bitmap.segments[i] {
+				heatmap[i][j>>10] += uint64(bits.OnesCount64(word))
+			}
+		}
+	})
+	return heatmap
+}
+
+// .png gets an image, anything else CSV
+func writeHeatmap(heatmap *[OCTET_MAX_VALUE][OCTET_MAX_VALUE]uint64, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if strings.EqualFold(filepath.Ext(filename), ".png") {
+		err = png.Encode(writer, heatmapImage(heatmap))
+	} else {
+		writeHeatmapCSV(writer, heatmap)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Same CSV flavour as -histogram-out: one row per first octet, one column per second octet
+func writeHeatmapCSV(writer *bufio.Writer, heatmap *[OCTET_MAX_VALUE][OCTET_MAX_VALUE]uint64) {
+	line := make([]byte, 0, OCTET_MAX_VALUE*8)
+
+	line = append(line, "octet"...)
+	for second := range OCTET_MAX_VALUE {
+		line = append(line, ',')
+		line = strconv.AppendInt(line, int64(second), 10)
+	}
+	writer.Write(append(line, '\r', '\n'))
+
+	for first, row := range heatmap {
+		line = strconv.AppendInt(line[:0], int64(first), 10)
+		for _, count := range row {
+			line = append(line, ',')
+			line = strconv.AppendUint(line, count, 10)
+		}
+		writer.Write(append(line, '\r', '\n'))
+	}
+}
+
+// 256x256 grayscale, x is the second octet and y the first. Brightness is log scaled,
+// a full /16 (65536) is white, otherwise a few busy blocks would leave everything else black
+func heatmapImage(heatmap *[OCTET_MAX_VALUE][OCTET_MAX_VALUE]uint64) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, OCTET_MAX_VALUE, OCTET_MAX_VALUE))
+	full := math.Log2(1<<16 + 1)
+
+	for first, row := range heatmap {
+		for second, count := range row {
+			img.SetGray(second, first, color.Gray{Y: uint8(math.Round(math.Log2(float64(count)+1) / full * 255))})
+		}
+	}
+	return img
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+	"sync"
+)
+
+// Workers hand addresses to the shared summary in batches, so the lock is taken once per batch
+const HEAVY_HITTERS_BATCH = 1 << 12
+
+// Space-Saving summary of the K most frequent addresses in fixed memory (K counters),
+// the bounded counterpart of the exact -top map.
+// Every reported count is an over-estimate: true count is in [Count - Error, Count],
+// and Error is at most N / K for N addresses seen. Any address seen more than N / K times
+// is guaranteed to be in the summary
+type HeavyHitters struct {
+	mu       sync.Mutex
+	capacity int
+	counters map[uint32]*heavyHitter
+	byCount  heavyHitterHeap // min-heap, root is the next one to evict
+}
+
+type heavyHitter struct {
+	ip    uint32
+	count uint64
+	err   uint64 // count inherited from the evicted counter
+	index int    // position in the heap
+}
+
+type HeavyHitterEntry struct {
+	Address string `json:"address"`
+	Count   uint64 `json:"count"`
+	Error   uint64 `json:"error"`
+}
+
+var heavyHitters *HeavyHitters
+
+func NewHeavyHitters(capacity int) *HeavyHitters {
+	return &HeavyHitters{capacity: capacity, counters: make(map[uint32]*heavyHitter, capacity)}
+}
+
+func (h *HeavyHitters) add(ips []uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ip := range ips {
+		if counter := h.counters[ip]; counter != nil {
+			counter.count++
+			heap.Fix(&h.byCount, counter.index)
+			continue
+		}
+
+		if len(h.byCount) < h.capacity {
+			counter := &heavyHitter{ip: ip, count: 1}
+			h.counters[ip] = counter
+			heap.Push(&h.byCount, counter)
+			continue
+		}
+
+		// Replace the smallest counter, new address inherits its count as the error
+		counter := h.byCount[0]
+		delete(h.counters, counter.ip)
+		counter.ip, counter.err = ip, counter.count
+		counter.count++
+		h.counters[ip] = counter
+		heap.Fix(&h.byCount, 0)
+	}
+}
+
+// All counters, largest first, ties are broken by address
+func (h *HeavyHitters) Top() []HeavyHitterEntry {
+	h.mu.Lock()
+	counters := slices.Clone(h.byCount)
+	h.mu.Unlock()
+
+	slices.SortFunc(counters, func(a, b *heavyHitter) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ip, b.ip)
+	})
+
+	top := make([]HeavyHitterEntry, 0, len(counters))
+	for _, counter := range counters {
+		top = append(top, HeavyHitterEntry{Address: string(appendIPv4(nil, counter.ip)), Count: counter.count, Error: counter.err})
+	}
+	return top
+}
+
+type heavyHitterHeap []*heavyHitter
+
+func (h heavyHitterHeap) Len() int           { return len(h) }
+func (h heavyHitterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h heavyHitterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *heavyHitterHeap) Push(x any) {
+	counter := x.(*heavyHitter)
+	counter.index = len(*h)
+	*h = append(*h, counter)
+}
+
+func (h *heavyHitterHeap) Pop() any {
+	old := *h
+	counter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return counter
+}
+
+// Per-worker batch in front of the shared summary
+type heavyHittersCounter struct {
+	inner Counter
+	hh    *HeavyHitters
+	batch []uint32
+}
+
+func (c *heavyHittersCounter) Add(ip uint32) {
+	c.inner.Add(ip)
+	c.batch = append(c.batch, ip)
+	if len(c.batch) == HEAVY_HITTERS_BATCH {
+		c.flush()
+	}
+}
+
+func (c *heavyHittersCounter) Count() uint64 {
+	return c.inner.Count()
+}
+
+func (c *heavyHittersCounter) flush() {
+	c.hh.add(c.batch)
+	c.batch = c.batch[:0]
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"strconv"
+)
+
+// Unique addresses per first octet
+func getHistogram(bitmap *Bitmap) [OCTET_MAX_VALUE]uint64 {
+	var histogram [OCTET_MAX_VALUE]uint64
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			histogram[i] = countSegmentBits(bitmap, i)
+		}
+	})
+	return histogram
+}
+
+// Set bits in [first, last], both inclusive. Bitmap is walked as one flat array of words
+func countRange(bitmap *Bitmap, first, last uint32) uint64 {
+	word := func(idx uint32) uint64 {
+		return bitmap.segments[idx>>18][idx&(BITMAP_SEGMENT_SIZE-1)]
+	}
+
+	firstWord, lastWord := first>>6, last>>6
+	firstMask := ^uint64(0) << (first & 63)
+	lastMask := ^uint64(0) >> (63 - last&63)
+
+	if firstWord == lastWord {
+		return uint64(bits.OnesCount64(word(firstWord) & firstMask & lastMask))
+	}
+
+	count := uint64(bits.OnesCount64(word(firstWord) & firstMask))
+	for idx := firstWord + 1; idx < lastWord; idx++ {
+		count += uint64(bits.OnesCount64(word(idx)))
+	}
+	return count + uint64(bits.OnesCount64(word(lastWord)&lastMask))
+}
+
+// "10.0.0.0/8" -> 10.0.0.0, 10.255.255.255
+func parseCIDR(value string) (uint32, uint32, error) {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !prefix.Addr().Is4() {
+		return 0, 0, fmt.Errorf("%s is not an IPv4 prefix", value)
+	}
+
+	addr := prefix.Masked().Addr().As4()
+	first := uint32(addr[0])<<24 | uint32(addr[1])<<16 | uint32(addr[2])<<8 | uint32(addr[3])
+	last := first | uint32(uint64(1)<<(32-prefix.Bits())-1)
+	return first, last, nil
+}
+
+// First octets without a single address
+func getEmptyShards(bitmap *Bitmap) []int {
+	empty := []int{}
+	for octet, count := range getHistogram(bitmap) {
+		if count == 0 {
+			empty = append(empty, octet)
+		}
+	}
+	return empty
+}
+
+// Sorted octets as a compact range list: 0, 10, 127, 224-255
+func formatOctetRanges(octets []int) string {
+	buf := []byte{}
+	for i := 0; i < len(octets); {
+		j := i
+		for j+1 < len(octets) && octets[j+1] == octets[j]+1 {
+			j++
+		}
+
+		if len(buf) > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = strconv.AppendInt(buf, int64(octets[i]), 10)
+		if j > i {
+			buf = append(buf, '-')
+			buf = strconv.AppendInt(buf, int64(octets[j]), 10)
+		}
+		i = j + 1
+	}
+	return string(buf)
+}
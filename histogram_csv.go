@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+)
+
+// RFC 4180 CSV: "octet,unique_count" header, CRLF line endings, plain integers.
+// Nothing needs quoting since every field is a number
+func writeHistogramCSV(histogram [OCTET_MAX_VALUE]uint64, filename string, all bool) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString("octet,unique_count\r\n")
+
+	line := make([]byte, 0, 32)
+	for octet, count := range histogram {
+		if count == 0 && !all {
+			continue
+		}
+		line = strconv.AppendInt(line[:0], int64(octet), 10)
+		line = append(line, ',')
+		line = strconv.AppendUint(line, count, 10)
+		line = append(line, '\r', '\n')
+		writer.Write(line)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
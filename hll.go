@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+const HLL_PRECISION = 14 // 16384 registers, ~0.8% standard error, 64 KB
+const DEFAULT_HASH_SEED = 0x5EED_1234_ABCD_0001
+
+// Approximate backend for when 512 MB is too much.
+// Estimate depends on the hash seed only, so same input + same seed = same estimate
+type HyperLogLog struct {
+	precision uint8
+	seed      uint64
+	registers []uint32
+}
+
+func NewHyperLogLog(precision uint8, seed uint64) *HyperLogLog {
+	return &HyperLogLog{
+		precision: precision,
+		seed:      seed,
+		registers: make([]uint32, 1<<precision),
+	}
+}
+
+// splitmix64 finalizer over seeded key
+func hashIP(ip uint32, seed uint64) uint64 {
+	x := uint64(ip) ^ seed
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+func (h *HyperLogLog) Add(ip uint32) {
+	hash := hashIP(ip, h.seed)
+	index := hash >> (64 - h.precision)
+	// Guard bit caps the rank, so it's never 64 zeros
+	rank := uint32(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+
+	register := &h.registers[index]
+	for {
+		old := atomic.LoadUint32(register)
+		if rank <= old || atomic.CompareAndSwapUint32(register, old, rank) {
+			return
+		}
+	}
+}
+
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+
+	for i := range h.registers {
+		rank := atomic.LoadUint32(&h.registers[i])
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Linear counting is more precise for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// 1.04 / sqrt(m) of the raw estimator, small sets (linear counting) are more precise than that
+func (h *HyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func isURL(filename string) bool {
+	return strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://")
+}
+
+// Body of a successful GET. Gzip content encoding is decoded transparently
+func openURL(url string) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: config.Timeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+
+	// Transport decodes gzip itself only when it asked for it
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		return readCloser{Reader: gz, close: resp.Body.Close}, nil
+	}
+	return resp.Body, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+func processURL(url string, process func(data []byte, chunk task)) {
+	body, err := openURL(url)
+	if err != nil {
+		fatal(err)
+	}
+	defer body.Close()
+
+	if isTarArchive(url) {
+		err = processTar(body, url, process)
+	} else {
+		err = processReader(wrapDecoder(body, config.InputEncoding), process)
+	}
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", url, err))
+	}
+}
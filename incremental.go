@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Unique count after one file of -incremental and how many of them the file added
+type FileContribution struct {
+	File       string `json:"file"`
+	Cumulative uint64 `json:"cumulative"`
+	New        uint64 `json:"new"`
+}
+
+// Union of files one by one, reporting to w after each (nil w - JSON gets the list instead).
+// Files go strictly in order, the last cumulative count is the union count
+func countIncremental(w io.Writer, filenames []string, counter Counter) ([]FileContribution, *LineStats, error) {
+	var contributions []FileContribution
+	var total *LineStats
+	previous := uint64(0)
+
+	for _, filename := range filenames {
+		var count uint64
+		if config.needsValidation() {
+			var stats *LineStats
+			var err error
+			count, stats, err = countUniqueIPsChecked([]string{filename}, counter)
+			if err != nil {
+				return nil, nil, err
+			}
+			if total == nil {
+				total = &LineStats{}
+			}
+			total.add(stats)
+		} else {
+			count = countUniqueIPs([]string{filename}, counter)
+		}
+
+		// hll estimate can even go down a bit
+		contribution := FileContribution{File: filename, Cumulative: count, New: count - min(previous, count)}
+		contributions = append(contributions, contribution)
+		if w != nil {
+			fmt.Fprintf(w, "after %s: %s unique (+%s)\n", filename, formatCount(count), formatCount(contribution.New))
+		}
+		previous = count
+	}
+
+	if total != nil {
+		total.finish()
+	}
+	return contributions, total, nil
+}
@@ -1,62 +1,586 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"math/bits"
 	"os"
 	"runtime"
-	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-var WORKERS_AMOUNT = runtime.NumCPU()     // 512 MB RAM for each worker. Using max threads - increases performance
-var WORKERS_SUM_AMOUNT = runtime.NumCPU() // Doesn't affect RAM or CPU
+var WORKERS_AMOUNT = runtime.NumCPU()         // Set from -workers or RecommendWorkers. Using max threads on big files - increases performance
+var WORKERS_SUM_AMOUNT = runtime.NumCPU()     // Doesn't affect RAM or CPU
+var WORKERS_MERGE_AMOUNT = WORKERS_SUM_AMOUNT // Set from -merge-workers. OR of whole bitmaps is memory bound, may want fewer
 
 // max value for 24 byte number / 64. For uint64
 // 32 - 8 = 24 -> 2^24 = 16 777 216 -> / 64
 const BITMAP_SEGMENT_SIZE = 262144
 const OCTET_MAX_VALUE = 256
 
+// Backend for storing seen addresses. Add must be safe for concurrent use
+type Counter interface {
+	Add(ip uint32)
+	Count() uint64
+}
+
+// Default dense backend: one bit per address, sharded by first octet
 type Bitmap struct {
 	segments [OCTET_MAX_VALUE][BITMAP_SEGMENT_SIZE]uint64
 }
 
-var bitmap = &Bitmap{}
+// Allocated by newCounter for the dense backend, nil otherwise
+var bitmap *Bitmap
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run ip_parser.go <filename>")
+	parseFlags()
+
+	if config.From0 != "" {
+		var err error
+		if manifestFiles, err = readManifest0(config.From0); err != nil {
+			fatal(fmt.Errorf("-from0: %w", err))
+		}
+	}
+
+	if len(inputFiles()) < 1 && config.Listen == "" && config.StreamWindow == 0 {
+		fmt.Println("Usage: go run . [flags] <filename>...")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if err := validateConfig(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	setupStdout()
+	defer flushStdout()
+
+	if config.Pin {
+		if err := initPinning(); err != nil {
+			fatal(err)
+		}
+	}
+	if config.MergeWorkers > 0 {
+		WORKERS_MERGE_AMOUNT = config.MergeWorkers
+	}
+	if config.Single {
+		WORKERS_AMOUNT, WORKERS_SUM_AMOUNT, WORKERS_MERGE_AMOUNT = 1, 1, 1
+	} else if config.Workers > 0 {
+		WORKERS_AMOUNT = config.Workers
+	} else if !config.MergeOnly && !config.Churn && !config.EstimateRun && !config.VerifyChecksum {
+		WORKERS_AMOUNT = RecommendFileWorkers(inputFiles(), config.ParallelFiles)
+	}
+
+	// Integrity check only, nothing gets counted
+	if config.VerifyChecksum {
+		if !verifySavedBitmaps(stdout, flag.Args()) {
+			exit(1)
+		}
+		return
+	}
+
+	// Prediction only, nothing gets counted
+	if config.EstimateRun {
+		printRunEstimate(stdout, estimateRun(flag.Arg(0)))
+		return
+	}
+
+	// Sorted input, streams and -parse-only are counted without any backend
+	var counter Counter
+	if !config.Sorted && config.StreamWindow == 0 && !config.ParseOnly {
+		counter = newCounter(config.Backend)
+	}
+	// Allocation may have fallen back to sparse, dense-only modes can't go on with it
+	if err := checkFallback(); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	if usesSmallInputTally(inputFiles()) {
+		smallInputTally = &atomic.Uint64{}
+	}
+
+	// Whatever the last run logged before it died is counted again
+	if config.CommitLog != "" {
+		replayed, end, err := replayCommitLog(bitmap, config.CommitLog)
+		if err != nil {
+			fatal(err)
+		}
+		if replayed > 0 {
+			fmt.Fprintf(os.Stderr, "Replayed %s addresses from %s\n", formatCount(replayed), config.CommitLog)
+		}
+		if commitLog, err = OpenCommitLog(config.CommitLog, end, config.CommitInterval); err != nil {
+			fatal(fmt.Errorf("-commit-log: %w", err))
+		}
+	}
+
+	if config.Allow != "" || config.Block != "" {
+		filter = newFilter(config.Allow, config.Block)
+	}
+
+	if config.Mask < 32 {
+		keyFn = maskKey(config.Mask)
+	}
+	if config.NewVsSaved != "" {
+		var err error
+		if savedBaseline, err = LoadBitmap(config.NewVsSaved); err != nil {
+			fatal(err)
+		}
+	}
+	if config.IPv6 {
+		ipv6 = NewIPv6Counter()
+	}
+	if config.Top > 0 || config.ListByFrequency {
+		frequencies = NewFrequencyMap(config.WithLocations)
+	}
+	if config.GroupByColumn > 0 {
+		groups = newGroupCounter()
+	}
+	if config.HeavyHitters > 0 {
+		heavyHitters = NewHeavyHitters(config.HeavyHitters)
+	}
+	if config.Resolve {
+		resolver = newHostResolver()
+	}
+	if config.RejectFile != "" {
+		var err error
+		if rejects, err = newRejectSink(config.RejectFile); err != nil {
+			fatal(fmt.Errorf("-reject-file: %w", err))
+		}
+	}
+
 	startTime := time.Now()
-	count := countUniqueIPs(os.Args[1])
+	if config.Deadline > 0 {
+		startDeadline(config.Deadline)
+	}
+	if config.Progress {
+		progress = startProgress(time.Second, config.ProgressFormat, uint64(inputBytes(inputFiles())))
+	}
+
+	var count uint64
+	var pairs *PairsResult
+	var churn *ChurnResult
+	var endpoints *EndpointsResult
+	var files []FileContribution
+	var benchmark *BenchmarkResult
+	var lineStats *LineStats
+	var parseOnly *ParseOnlyResult
+
+	if config.Listen != "" {
+		var err error
+		count, err = runListener(config.Listen, &ConcurrentCounter{bitmap: bitmap})
+		if err != nil {
+			fatal(err)
+		}
+	} else if config.Follow {
+		var err error
+		count, err = runFollow(flag.Arg(0), &ConcurrentCounter{bitmap: bitmap})
+		if err != nil {
+			fatal(err)
+		}
+	} else if config.StreamWindow > 0 {
+		count = runStreamWindow(os.Stdin, stdout, config.StreamWindow, config.StreamInterval)
+	} else if config.ParseOnly {
+		parseOnly = runParseOnly(inputFiles())
+	} else if config.Window > 0 {
+		count = runRollingWindow(stdout, config.Window, flag.Args())
+	} else if config.Churn {
+		yesterday, err := LoadBitmap(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		if err := loadBitmapInto(bitmap, flag.Arg(1)); err != nil {
+			fatal(err)
+		}
+		churnResult := getChurn(yesterday, bitmap)
+		churn = &churnResult
+		count = bitmap.Count()
+	} else if config.MergeOnly {
+		if err := mergeSavedBitmaps(bitmap, flag.Args()); err != nil {
+			fmt.Println(err)
+			exit(1)
+		}
+		count = bitmap.Count()
+	} else if config.CountUniquePorts {
+		endpointsResult := countUniqueEndpoints(flag.Args())
+		endpoints = &endpointsResult
+		count = endpoints.Endpoints
+	} else if config.Pairs {
+		pairsResult := countUniquePairs(flag.Args(), config.PairColumns)
+		pairs = &pairsResult
+		count = pairs.Pairs
+	} else if config.Sorted {
+		var err error
+		count, err = countUniqueSorted(flag.Arg(0), config.VerifySorted)
+		if err != nil {
+			fatal(err)
+		}
+	} else if config.MeasureRuns > 0 {
+		count, benchmark = runBenchmark(flag.Args(), bitmap, config.WarmupRuns, config.MeasureRuns)
+	} else if config.RawBinary {
+		count = countUniqueRaw(flag.Args(), counter, config.LittleEndian)
+	} else if config.Incremental {
+		// JSON gets the list as part of the result, -list owns stdout
+		var w io.Writer = stdout
+		if config.JSON || config.Template != nil {
+			w = nil
+		} else if config.List || config.ListByFrequency {
+			w = os.Stderr
+		}
+
+		var err error
+		files, lineStats, err = countIncremental(w, inputFiles(), counter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(EXIT_MALFORMED_LINE)
+		}
+		if len(files) > 0 {
+			count = files[len(files)-1].Cumulative
+		}
+	} else if config.needsValidation() {
+		var err error
+		count, lineStats, err = countUniqueIPsChecked(inputFiles(), counter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(EXIT_MALFORMED_LINE)
+		}
+	} else {
+		count = countUniqueIPs(inputFiles(), counter)
+	}
+
+	if progress != nil {
+		progress.stop()
+	}
+	if rejects != nil {
+		if err := rejects.close(); err != nil {
+			fatal(fmt.Errorf("-reject-file: %w", err))
+		}
+	}
+	if commitLog != nil {
+		if err := commitLog.Close(); err != nil {
+			fatal(fmt.Errorf("-commit-log: %w", err))
+		}
+	}
 	timeElapsed := time.Since(startTime)
 
-	fmt.Println("Unique IP addresses amount: ", count)
-	fmt.Println("Time elapsed: ", timeElapsed)
+	if config.Save != "" {
+		if err := SaveBitmap(bitmap, config.Save); err != nil {
+			panic(err.Error())
+		}
+	}
+
+	if config.CompactSave != "" {
+		if err := SaveBitmapCompact(bitmap, config.CompactSave); err != nil {
+			fatal(err)
+		}
+	}
+
+	var appended *AppendResult
+	if config.AppendSave != "" {
+		appendResult, err := appendSaveBitmap(bitmap, config.AppendSave)
+		if err != nil {
+			fatal(err)
+		}
+		appended = &appendResult
+
+		// Checkpoint: the log is in the saved bitmap now
+		if config.CommitLog != "" {
+			if err := truncateCommitLog(config.CommitLog); err != nil {
+				fatal(fmt.Errorf("-commit-log: %w", err))
+			}
+		}
+	}
+
+	// Everything after this point (outputs, -list) sees only the new addresses
+	var newSinceBaseline *uint64
+	if savedBaseline != nil {
+		newSinceBaseline = &count
+	}
+	if config.Baseline != "" {
+		baseline, err := LoadBitmap(config.Baseline)
+		if err != nil {
+			fatal(err)
+		}
+		bitmap.AndNot(baseline)
+		newCount := bitmap.Count()
+		newSinceBaseline = &newCount
+
+		if config.DiffSave != "" {
+			if err := SaveBitmap(bitmap, config.DiffSave); err != nil {
+				fatal(err)
+			}
+		}
+	}
+
+	if config.HistogramOut != "" {
+		if err := writeHistogramCSV(getHistogram(bitmap), config.HistogramOut, config.HistogramAll); err != nil {
+			fatal(err)
+		}
+	}
+
+	if config.Heatmap != "" {
+		if err := writeHeatmap(getHeatmap(bitmap), config.Heatmap); err != nil {
+			fatal(err)
+		}
+	}
+
+	if config.Bloom != "" {
+		bloom := buildBloomFilter(bitmap, count, config.BloomFP)
+		if err := SaveBloomFilter(bloom, config.Bloom); err != nil {
+			panic(err.Error())
+		}
+	}
+
+	if config.SplitOutput != "" {
+		writeSplitOutput(bitmap, config.SplitOutput, config.SplitOutputEmpty)
+	}
+
+	result := Result{Unique: count, Elapsed: timeElapsed, Pairs: pairs, Churn: churn, Endpoints: endpoints, Files: files, Lines: lineStats, Appended: appended, NewSinceBaseline: newSinceBaseline, HeadBytes: config.HeadBytes, TimedOut: deadlineExpired.Load(), TimedOutFiles: timedOutFiles, LongLines: longLines.Load(), FileDuplicates: fileDuplicates, Entries: archiveEntries.Load(), Benchmark: benchmark, ParseOnly: parseOnly}
+	if filter != nil {
+		result.Filtered = filter.stats()
+	}
+	// -list-by-frequency prints the top itself
+	if frequencies != nil && !config.ListByFrequency {
+		result.Top = frequencies.Top(config.Top)
+	}
+	if config.EmptyShards {
+		result.EmptyShards = getEmptyShards(bitmap)
+	}
+	if config.Fingerprint {
+		result.Fingerprint = bitmap.Fingerprint()
+	}
+	if config.MultiPerLine {
+		result.Tokens = getTokenStats()
+	}
+	if estimator, ok := counter.(Estimator); ok {
+		result.Confidence = getConfidence(count, estimator.StandardError(), config.Confidence)
+	}
+	if config.From0 != "" {
+		result.Manifest = &ManifestResult{Listed: len(manifestFiles), Processed: filesProcessed.Load()}
+	}
+	if groups != nil {
+		result.Groups = groups.counts()
+	}
+	if heavyHitters != nil {
+		result.HeavyHitters = heavyHitters.Top()
+	}
+	if ipv6 != nil {
+		result.IPv6 = ipv6.result()
+	}
+	if config.Combined {
+		result.Combined = getCombined(count, result.IPv6)
+	}
+	if resolver != nil {
+		result.Resolve = &resolver.stats
+	}
+	if config.Debug && config.Backend == BACKEND_DENSE && !config.Pairs && !config.CountUniquePorts && !config.Sorted {
+		debugStats := getBitmapDebugStats(bitmap)
+		if newSinceBaseline != nil {
+			verifyBitmapDebugStats(debugStats, *newSinceBaseline)
+		} else {
+			verifyBitmapDebugStats(debugStats, count)
+		}
+		result.Debug = &debugStats
+	}
+	if config.Debug {
+		result.ShardBalance = getShardBalances(counter)
+		result.Chunks = getChunkProfiles()
+	}
+	if config.Stats && config.Backend == BACKEND_DENSE {
+		result.Range = getAddressRange(bitmap)
+	}
+	result.checkExpected(config.Expect)
+	result.checkMalformedThreshold(config.WarnThreshold)
+
+	// Addresses own stdout in list mode
+	if config.JSONFull {
+		printFullSummary(stdout, getFullSummary(result, bitmap, inputFiles()))
+	} else if config.List {
+		writeList(bitmap, stdout, config.ListFormat)
+		printResult(os.Stderr, result)
+	} else if config.ListByFrequency {
+		frequencies.WriteRanked(stdout, config.Top)
+		printResult(os.Stderr, result)
+	} else {
+		printResult(stdout, result)
+	}
+
+	if config.Repl {
+		runRepl(bitmap, os.Stdin, stdout)
+	}
+
+	if result.TimedOut {
+		exit(EXIT_DEADLINE)
+	}
+	if result.Match != nil && !*result.Match {
+		exit(EXIT_EXPECT_MISMATCH)
+	}
+	if result.ThresholdExceeded && config.FailOnWarn {
+		exit(EXIT_MALFORMED_THRESHOLD)
+	}
+}
+
+func countUniqueIPs(filenames []string, counter Counter) uint64 {
+	processFilesInto(filenames, counter, func(counter Counter) (func(data []byte, chunk task), func()) {
+		return func(data []byte, chunk task) {
+			countChunk(data, chunk, counter)
+		}, func() {}
+	})
+
+	return countCounter(counter)
+}
+
+// One chunk of the fast path, through the worker's wrappers (filters, progress, commit log)
+func countChunk(data []byte, chunk task, counter Counter) {
+	worker, done := workerCounter(counter)
+	if config.MultiPerLine {
+		processChunkMulti(data, chunk.start, chunk.end, worker)
+	} else if config.Prefix >= 0 {
+		processChunkPrefix(data, chunk.start, chunk.end, worker, byte(config.Prefix))
+	} else {
+		processChunk(data, chunk.start, chunk.end, worker)
+	}
+	done()
+}
+
+// Union of all files: up to -parallel-files files are in flight, each with its own pool of
+// WORKERS_AMOUNT chunk workers, all setting bits in the same counter
+func processFiles(filenames []string, process func(data []byte, chunk task)) {
+	files := make(chan task, len(filenames))
+	for i := range filenames {
+		files <- task{index: i}
+	}
+	close(files)
+
+	runWorkers(min(config.ParallelFiles, len(filenames)), files, func(t task) {
+		if deadlineExpired.Load() || errexit.stoppedFile(t.index) {
+			return
+		}
+		processFile(filenames[t.index], tagFile(t.index, process))
+		filesProcessed.Add(1)
+	})
+}
+
+// Tags chunks with their input file
+func tagFile(file int, process func(data []byte, chunk task)) func(data []byte, chunk task) {
+	return func(data []byte, chunk task) {
+		chunk.file = file
+		process(data, chunk)
+	}
 }
 
-func countUniqueIPs(filename string) uint64 {
+// Mmaps the file and runs process over line-aligned chunks, one worker per chunk.
+// URLs, tar archives, UTF-16 files and piped stdin are streamed through the reader path instead
+func processFile(filename string, process func(data []byte, chunk task)) {
+	if config.Debug {
+		process = profileChunks(filename, process)
+	}
+	if progress != nil {
+		process = progressChunks(process)
+	}
+	if config.Deadline > 0 {
+		process = deadlineChunks(process)
+	}
+
+	if isURL(filename) {
+		processURL(filename, process)
+		return
+	}
+	if isTarArchive(filename) {
+		processTarFile(filename, process)
+		return
+	}
+	if isFDInput(filename) {
+		processFD(filename, process)
+		return
+	}
+	if filename == STDIN_INPUT {
+		processStdin(process)
+		return
+	}
+	if needsDecoding(config.InputEncoding) {
+		processDecodedFile(filename, process)
+		return
+	}
+
 	data, closeFile := getMmapDataFromFilename(filename)
 	defer closeFile()
 
+	processMapped(filename, data, process)
+}
+
+// Everything after the mmap: BOM, -head-bytes, header, chunking
+func processMapped(filename string, data []byte, process func(data []byte, chunk task)) {
+	data, err := stripBOM(data)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", filename, err))
+	}
+
+	// Pages past the window are never touched, so they are never read from disk
+	if config.HeadBytes > 0 {
+		data = headBytes(data, config.HeadBytes)
+	}
+
+	// Header goes away before chunking, so no worker ever sees it
+	data = skipLines(data, config.SkipHeader)
+
+	// Empty (or only blank lines) file is a valid input with zero addresses, not an error
+	if len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+
 	offsets := getChunkOffsets(data)
+	if config.Debug {
+		verifyChunkOffsets(data, offsets)
+	}
 
-	var wg sync.WaitGroup
+	var lines []uint64
+	if config.needsLineNumbers() {
+		lines = getChunkStartLines(data, offsets)
+	}
+
+	runChunkWorkers(WORKERS_AMOUNT, offsetTasks(offsets, lines), func(t task) {
+		process(data, t)
+	})
+}
+
+// Line number of every chunk start: newlines of each chunk are counted in parallel, then summed up
+func getChunkStartLines(data []byte, offsets []int) []uint64 {
+	chunkLines := make([]uint64, len(offsets)-1)
+	runWorkers(WORKERS_AMOUNT, offsetTasks(offsets, nil), func(t task) {
+		chunkLines[t.index] = uint64(bytes.Count(data[t.start:t.end], []byte{'\n'}))
+	})
 
-	wg.Add(WORKERS_AMOUNT)
-	for i := 0; i < WORKERS_AMOUNT; i++ {
-		go func(start, end int) {
-			defer wg.Done()
-			processChunk(data, start, end, bitmap)
-		}(offsets[i], offsets[i+1])
+	lines := make([]uint64, len(offsets)-1)
+	for i := 1; i < len(lines); i++ {
+		lines[i] = lines[i-1] + chunkLines[i-1]
 	}
-	wg.Wait()
+	return lines
+}
 
-	return countBitsParallel(bitmap)
+// First n bytes of data, cut back to the last complete line
+func headBytes(data []byte, n int64) []byte {
+	if n >= int64(len(data)) {
+		return data
+	}
+	return data[:bytes.LastIndexByte(data[:n], '\n')+1]
+}
+
+// Cuts the first n lines off data
+func skipLines(data []byte, n int) []byte {
+	for ; n > 0 && len(data) > 0; n-- {
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			return data[len(data):]
+		}
+		data = data[idx+1:]
+	}
+	return data
 }
 
 func getChunkOffsets(data []byte) []int {
@@ -84,64 +608,156 @@ func getChunkOffsets(data []byte) []int {
 			}
 		}
 
+		// Last line without trailing '\n' - the rest of data belongs to the previous chunk
+		if idx == -1 {
+			for k := i; k < WORKERS_AMOUNT; k++ {
+				offsets[k] = len(data)
+			}
+			break
+		}
+
 		offsets[i] = proposed + idx + 1
 	}
 
 	return offsets
 }
 
+// Lines over -max-line-length skipped unparsed by the paths without line stats
+var longLines atomic.Uint64
+
 // Handling data chuck from mmap file
-func processChunk(data []byte, start, end int, bitmap *Bitmap) {
+func processChunk(data []byte, start, end int, counter Counter) {
+	// Dense bitmap gets a loop without interface calls per line
+	if bitmap, ok := counter.(*Bitmap); ok && config.Single {
+		processChunkSingle(data, start, end, bitmap)
+		return
+	} else if ok {
+		processChunkBitmap(data, start, end, bitmap)
+		return
+	}
+
+	lineStart := start
+	maxLine := config.lineLengthLimit()
+
+	for i := start; i < end; i++ {
+		if data[i] == '\n' {
+			if i-lineStart <= maxLine {
+				first, rest := parseIPv4(data, lineStart, i)
+				counter.Add(uint32(first)<<24 | rest)
+			} else {
+				longLines.Add(1)
+			}
+			lineStart = i + 1
+			i += 7 // skip forward
+		}
+	}
+
+	if lineStart < end && end-lineStart <= maxLine {
+		first, rest := parseIPv4(data, lineStart, end)
+		counter.Add(uint32(first)<<24 | rest)
+	} else if lineStart < end {
+		longLines.Add(1)
+	}
+}
+
+func processChunkBitmap(data []byte, start, end int, bitmap *Bitmap) {
 	lineStart := start
+	maxLine := config.lineLengthLimit()
 
 	// Parsing IP inline avoiding double checking - does not improve performance
 	for i := start; i < end; i++ {
 		if data[i] == '\n' {
-			first, rest := parseIPv4(data, lineStart, i)
-			setBitLocal(bitmap, first, rest)
+			if i-lineStart <= maxLine {
+				first, rest := parseIPv4(data, lineStart, i)
+				setBitLocal(bitmap, first, rest)
+			} else {
+				longLines.Add(1)
+			}
 			lineStart = i + 1
 			i += 7 // skip forward
 		}
 	}
 
-	if lineStart < end {
+	if lineStart < end && end-lineStart <= maxLine {
 		first, rest := parseIPv4(data, lineStart, end)
 		setBitLocal(bitmap, first, rest)
+	} else if lineStart < end {
+		longLines.Add(1)
 	}
 }
 
-// Mark in bitmap as existing
+// Ground truth for -single: the simplest possible loop - every line, no skipping forward,
+// plain OR. Only correct because nothing else touches the bitmap at the same time
+func processChunkSingle(data []byte, start, end int, bitmap *Bitmap) {
+	lineStart := start
+	maxLine := config.lineLengthLimit()
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+		if i-lineStart > maxLine {
+			longLines.Add(1)
+		} else if i > lineStart {
+			first, rest := parseIPv4(data, lineStart, i)
+			bitmap.segments[first][rest>>6] |= uint64(1) << (rest & 63)
+		}
+		lineStart = i + 1
+	}
+}
+
+// Mark in bitmap as existing. Safe for concurrent use, and that's required, not an option:
+// chunks are split by bytes, not by address, so any two workers can set bits of the same word -
+// the same address, or 64 neighbour addresses (x.y.z.0-63) sharing one uint64.
+// A plain |= is a read-modify-write: one worker would overwrite the other's bit and
+// the address would silently go missing from the count. Don't "optimize" the atomic away
 func setBitLocal(bitmap *Bitmap, bitmapShardIndex byte, rest uint32) {
 	wordIdx := rest >> 6
 	bitIdx := rest & 63
 
-	// Atomic doesn't affect performance
+	// Atomic doesn't affect performance: it's uncontended almost always
 	atomic.OrUint64(&bitmap.segments[bitmapShardIndex][wordIdx], uint64(1)<<bitIdx)
 }
 
-func countBitsParallel(bitmap *Bitmap) uint64 {
-	segmentsPerWorker := (OCTET_MAX_VALUE + WORKERS_SUM_AMOUNT - 1) / WORKERS_SUM_AMOUNT
+func (b *Bitmap) Add(ip uint32) {
+	setBitLocal(b, byte(ip>>24), ip&0xFFFFFF)
+}
+
+func (b *Bitmap) Contains(ip uint32) bool {
+	return atomic.LoadUint64(&b.segments[ip>>24][ip&0xFFFFFF>>6])&(uint64(1)<<(ip&63)) != 0
+}
+
+// Same as Add, but reports whether the address wasn't seen before (0 -> 1 transition)
+func (b *Bitmap) AddNew(ip uint32) bool {
+	mask := uint64(1) << (ip & 63)
+	old := atomic.OrUint64(&b.segments[ip>>24][ip&0xFFFFFF>>6], mask)
+	return old&mask == 0
+}
 
+func (b *Bitmap) Count() uint64 {
+	return countBitsParallel(b)
+}
+
+// Zeroes the bitmap for reuse instead of allocating another 512 MB.
+// Segments are cleared in parallel (clear compiles to memclr).
+// Not safe to call while workers are still adding
+func (b *Bitmap) Reset() {
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			clear(b.segments[i][:])
+		}
+	})
+}
+
+func countBitsParallel(bitmap *Bitmap) uint64 {
 	counts := make([]uint64, WORKERS_SUM_AMOUNT)
-	var wg sync.WaitGroup
-
-	wg.Add(WORKERS_SUM_AMOUNT)
-	for w := 0; w < WORKERS_SUM_AMOUNT; w++ {
-		go func(workerIndex int) {
-			defer wg.Done()
-			start := workerIndex * segmentsPerWorker
-			end := min(start+segmentsPerWorker, OCTET_MAX_VALUE)
-
-			localCount := uint64(0)
-			for i := start; i < end; i++ {
-				for j := 0; j < BITMAP_SEGMENT_SIZE; j++ {
-					localCount += uint64(bits.OnesCount64(bitmap.segments[i][j]))
-				}
-			}
-			counts[workerIndex] = localCount
-		}(w)
-	}
-	wg.Wait()
+
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		localCount := uint64(0)
+		for i := t.start; i < t.end; i++ {
+			localCount += countSegmentBits(bitmap, i)
+		}
+		counts[t.index] = localCount
+	})
 
 	total := uint64(0)
 	for _, c := range counts {
@@ -150,6 +766,15 @@ func countBitsParallel(bitmap *Bitmap) uint64 {
 	return total
 }
 
+func countSegmentBits(bitmap *Bitmap, octet int) uint64 {
+	count := uint64(0)
+	for j := 0; j < BITMAP_SEGMENT_SIZE; j++ {
+		// Atomic load - bitmap can be counted while a live counter is still adding
+		count += uint64(bits.OnesCount64(atomic.LoadUint64(&bitmap.segments[octet][j])))
+	}
+	return count
+}
+
 // Faster than net.IP without extra allocations
 func parseIPv4(data []byte, start, end int) (firstOctet byte, restOctets uint32) {
 	var currentOctet uint32
@@ -181,18 +806,30 @@ func getMmapDataFromFilename(filename string) ([]byte, func()) {
 	if err != nil {
 		panic(err.Error())
 	}
+	return getMmapDataFromFile(file)
+}
 
+// Takes ownership of file, it's closed by the returned func
+func getMmapDataFromFile(file *os.File) ([]byte, func()) {
 	fileInfo, _ := file.Stat()
 	fileSize := fileInfo.Size()
 
+	// Mmap rejects zero length with EINVAL
+	if fileSize == 0 {
+		return nil, func() {
+			file.Close()
+		}
+	}
+
 	// Faster than scanner (2min) or reader( 4min ) with simple inline reading
-	data, err := syscall.Mmap(int(file.Fd()), 0, int(fileSize), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	data, err := mmapRetry(int(file.Fd()), 0, int(fileSize), syscall.PROT_READ, syscall.MAP_PRIVATE)
 	if err != nil {
 		panic(err.Error())
 	}
+	adviseMmap(data, config.MmapAdvise)
 
 	return data, func() {
-		syscall.Munmap(data)
+		munmapRetry(data)
 		file.Close()
 	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync/atomic"
+)
+
+// IPv6 side of -ipv6: distinct hosts and distinct /64 networks.
+// IPv4-mapped addresses (::ffff:1.2.3.4) are routed to the IPv4 counter instead
+type IPv6Counter struct {
+	hosts    *ShardedSet[[16]byte]
+	networks *ShardedSet[uint64] // high 64 bits
+	mapped   atomic.Uint64
+}
+
+type IPv6Result struct {
+	Hosts      uint64 `json:"hosts"`
+	Networks64 uint64 `json:"networks_64"`
+	Mapped     uint64 `json:"mapped_lines"` // went to the IPv4 counter
+}
+
+// -combined: one distinct endpoints number over both families
+type CombinedResult struct {
+	Total uint64 `json:"total"`
+	IPv4  uint64 `json:"ipv4"` // mapped addresses included
+	IPv6  uint64 `json:"ipv6"`
+}
+
+var ipv6 *IPv6Counter
+
+func NewIPv6Counter() *IPv6Counter {
+	return &IPv6Counter{
+		hosts: NewShardedSet(func(key [16]byte) int {
+			return shardIndex(binary.BigEndian.Uint64(key[:8]) ^ binary.BigEndian.Uint64(key[8:]))
+		}),
+		networks: NewShardedSet(shardIndex),
+	}
+}
+
+// False for anything that isn't a valid IPv6 address. Parsing goes through netip,
+// which is much slower than the IPv4 parser, but IPv6 lines are expected to be a minority
+func (c *IPv6Counter) add(data []byte, start, end int, counter Counter) bool {
+	for start < end && isSpace(data[start]) {
+		start++
+	}
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+
+	addr, err := netip.ParseAddr(string(data[start:end]))
+	if err != nil || !addr.Is6() {
+		return false
+	}
+
+	if addr.Is4In6() {
+		v4 := addr.Unmap().As4()
+		counter.Add(binary.BigEndian.Uint32(v4[:]))
+		c.mapped.Add(1)
+		return true
+	}
+
+	host := addr.As16()
+	c.hosts.Add(host)
+	c.networks.Add(binary.BigEndian.Uint64(host[:8]))
+	return true
+}
+
+func (c *IPv6Counter) result() *IPv6Result {
+	return &IPv6Result{Hosts: c.hosts.Count(), Networks64: c.networks.Count(), Mapped: c.mapped.Load()}
+}
+
+// The families can't overlap: a mapped address never reaches the IPv6 sets, it is counted
+// as the IPv4 address it carries, so 1.2.3.4 and ::ffff:1.2.3.4 are one endpoint
+// and the total is a plain sum
+func getCombined(ipv4Unique uint64, ipv6Result *IPv6Result) *CombinedResult {
+	return &CombinedResult{Total: ipv4Unique + ipv6Result.Hosts, IPv4: ipv4Unique, IPv6: ipv6Result.Hosts}
+}
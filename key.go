@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Normalization applied to every address before it's counted. The count is then the
+// number of distinct keys, e.g. distinct /24 networks for a /24 mask.
+// keyFn must be pure: it's called from many workers at once, in any order
+type keyCounter struct {
+	inner Counter
+	keyFn func(ip uint32) uint32
+}
+
+// Library hook: wraps any Counter so it counts keyFn(ip) instead of ip
+func NewKeyCounter(inner Counter, keyFn func(ip uint32) uint32) Counter {
+	return &keyCounter{inner: inner, keyFn: keyFn}
+}
+
+func (c *keyCounter) Add(ip uint32) {
+	c.inner.Add(c.keyFn(ip))
+}
+
+func (c *keyCounter) Count() uint64 {
+	return c.inner.Count()
+}
+
+// keyFn of -mask, nil without it
+var keyFn func(ip uint32) uint32
+
+// Keeps the first bits of the address: the network address of its /bits
+func maskKey(bits int) func(ip uint32) uint32 {
+	mask := ^uint32(0) << (32 - bits)
+	if bits == 0 {
+		mask = 0
+	}
+	return func(ip uint32) uint32 {
+		return ip & mask
+	}
+}
+
+// "/24" or "24"
+func parseMask(value string) (int, error) {
+	bits, err := strconv.Atoi(strings.TrimPrefix(value, "/"))
+	if err != nil || bits < 0 || bits > 32 {
+		return 0, fmt.Errorf("mask must be /0 - /32")
+	}
+	return bits, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Malformed lines spread over all chunks are reported at their line in the file,
+// counted from -line-base, with -skip-header lines included
+func TestLineNumbersAcrossChunks(t *testing.T) {
+	var input strings.Builder
+	var bad []uint64 // 0-based
+	input.WriteString("address\n")
+	for i := uint64(1); i <= 1000; i++ {
+		if i%97 == 0 {
+			input.WriteString("BAD\n")
+			bad = append(bad, i)
+		} else {
+			input.WriteString("10.0.0.1\n")
+		}
+	}
+	filename := writeInput(t, "lines.txt", input.String())
+
+	for _, base := range []int{0, 1} {
+		for _, workers := range []int{1, 4, 7} {
+			resetConfig(t)
+			config.Stats = true
+			config.MaxExamples = len(bad)
+			config.SkipHeader = 1
+			config.LineBase = base
+			WORKERS_AMOUNT = workers
+
+			_, stats, err := countUniqueIPsChecked([]string{filename}, newTestBitmap(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint64
+			for _, example := range stats.Examples {
+				got = append(got, example.Line-uint64(base))
+			}
+			if !slices.Equal(got, bad) {
+				t.Errorf("-line-base %d, %d workers: got lines %v, want %v", base, workers, got, bad)
+			}
+		}
+	}
+}
+
+func TestChunkStartLines(t *testing.T) {
+	resetConfig(t)
+	WORKERS_AMOUNT = 5
+	data := []byte(strings.Repeat("1.2.3.4\n", 100))
+
+	offsets := getChunkOffsets(data)
+	lines := getChunkStartLines(data, offsets)
+	for i, start := range offsets[:len(offsets)-1] {
+		if want := uint64(start / len("1.2.3.4\n")); lines[i] != want {
+			t.Errorf("chunk %d at %d: got line %d, want %d", i, start, lines[i], want)
+		}
+	}
+}
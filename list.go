@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	LIST_FORMAT_DOTTED = "dotted"
+	LIST_FORMAT_INT    = "int"
+	LIST_FORMAT_HEX    = "hex"
+
+	// -list-binary: 4 byte records without separators, like -raw-binary reads them
+	LIST_FORMAT_BINARY_BE = "binary-be"
+	LIST_FORMAT_BINARY_LE = "binary-le"
+)
+
+// Appends ip in one of the list formats. All of them keep numeric order
+func appendListFormat(buf []byte, ip uint32, format string) []byte {
+	switch format {
+	case LIST_FORMAT_INT:
+		return strconv.AppendUint(buf, uint64(ip), 10)
+	case LIST_FORMAT_HEX:
+		const hexDigits = "0123456789ABCDEF"
+		buf = append(buf, '0', 'x')
+		for shift := 28; shift >= 0; shift -= 4 {
+			buf = append(buf, hexDigits[ip>>shift&0xF])
+		}
+		return buf
+	case LIST_FORMAT_BINARY_BE:
+		return binary.BigEndian.AppendUint32(buf, ip)
+	case LIST_FORMAT_BINARY_LE:
+		return binary.LittleEndian.AppendUint32(buf, ip)
+	default:
+		return appendIPv4(buf, ip)
+	}
+}
+
+func validateListFormat(format string) error {
+	switch format {
+	case LIST_FORMAT_DOTTED, LIST_FORMAT_INT, LIST_FORMAT_HEX:
+		return nil
+	}
+	return fmt.Errorf("unknown list format %q, expected dotted, int or hex", format)
+}
+
+// Writes every unique address in strictly ascending 32 bit order, one per line.
+// Order is a contract (people diff outputs and feed them to comm/join): blocks are
+// written 0..65535, words 0..N and bits 0..63, which is exactly the numeric order
+func writeList(bitmap *Bitmap, w io.Writer, format string) {
+	writer := bufio.NewWriterSize(w, 1<<20)
+
+	renderBlocksOrdered(bitmap, func(buf []byte, ip uint32) []byte {
+		if format == LIST_FORMAT_BINARY_BE || format == LIST_FORMAT_BINARY_LE {
+			return appendListFormat(buf, ip, format)
+		}
+		return append(appendListFormat(buf, ip, format), '\n')
+	}, func(block int, data []byte) {
+		writer.Write(data)
+	})
+
+	if err := writer.Flush(); err != nil {
+		panic(err.Error())
+	}
+}
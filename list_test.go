@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Scattered over the whole space, with the edges, neighbours in one word and a hot /8
+// spread over many /16 blocks, so the parallel block rendering has work in every batch
+func scatteredAddresses() []uint32 {
+	r := rand.New(rand.NewPCG(1, 2))
+	ips := []uint32{0, 1, 63, 64, 0xFFFFFFFF, 0xFFFFFFC0, 0x0A000000, 0x0A00003F}
+	for range 5000 {
+		ips = append(ips, r.Uint32())
+	}
+	for range 5000 {
+		ips = append(ips, 0x0A000000|r.Uint32()&0xFFFFFF)
+	}
+	return ips
+}
+
+func TestWriteListAscending(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		for _, format := range []string{LIST_FORMAT_DOTTED, LIST_FORMAT_INT, LIST_FORMAT_HEX, LIST_FORMAT_BINARY_BE, LIST_FORMAT_BINARY_LE} {
+			resetConfig(t)
+			WORKERS_SUM_AMOUNT = workers
+
+			ips := scatteredAddresses()
+			b := newTestBitmap(t)
+			for _, ip := range ips {
+				b.Add(ip)
+			}
+
+			var out bytes.Buffer
+			writeList(b, &out, format)
+			listed := parseList(t, out.Bytes(), format)
+
+			for i := 1; i < len(listed); i++ {
+				if listed[i] <= listed[i-1] {
+					t.Fatalf("%s, %d workers: %08X after %08X at %d", format, workers, listed[i], listed[i-1], i)
+				}
+			}
+			slices.Sort(ips)
+			if want := slices.Compact(ips); !slices.Equal(listed, want) {
+				t.Errorf("%s, %d workers: listed %d addresses, want %d", format, workers, len(listed), len(want))
+			}
+		}
+	}
+}
+
+// Back from any list format to numbers
+func parseList(t *testing.T, data []byte, format string) []uint32 {
+	t.Helper()
+	var ips []uint32
+
+	switch format {
+	case LIST_FORMAT_BINARY_BE, LIST_FORMAT_BINARY_LE:
+		order := binary.ByteOrder(binary.BigEndian)
+		if format == LIST_FORMAT_BINARY_LE {
+			order = binary.LittleEndian
+		}
+		for i := 0; i+4 <= len(data); i += 4 {
+			ips = append(ips, order.Uint32(data[i:]))
+		}
+		return ips
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var ip uint64
+		var err error
+		switch format {
+		case LIST_FORMAT_INT:
+			ip, err = strconv.ParseUint(line, 10, 32)
+		case LIST_FORMAT_HEX:
+			ip, err = strconv.ParseUint(strings.TrimPrefix(line, "0x"), 16, 32)
+		default:
+			parsed, ok := parseIPv4Strict([]byte(line), 0, len(line))
+			ip, err = uint64(parsed), nil
+			if !ok {
+				t.Fatalf("bad line %q", line)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ips = append(ips, uint32(ip))
+	}
+	return ips
+}
+
+// One hot /8 is the case the /16 split exists for
+func BenchmarkWriteListOneSlash8(b *testing.B) {
+	bm, err := allocateBitmap()
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := rand.New(rand.NewPCG(3, 4))
+	for range 1 << 20 {
+		bm.Add(0x0A000000 | r.Uint32()&0xFFFFFF)
+	}
+	for b.Loop() {
+		writeList(bm, io.Discard, LIST_FORMAT_DOTTED)
+	}
+}
+
+// A full /16 into a file, plain or behind -stdout-buffered. -list has its own buffer, so the
+// flag only pays off for outputs of many small writes, like a line per address:
+// go test -bench StdoutSlash16
+func BenchmarkStdoutSlash16(b *testing.B) {
+	bm := newTestBitmap(b)
+	for i := range uint32(1 << 16) {
+		bm.Add(0x0A010000 | i)
+	}
+	file, err := os.Create(filepath.Join(b.TempDir(), "out.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	outputs := []struct {
+		name  string
+		write func(w io.Writer)
+	}{
+		{"list", func(w io.Writer) { writeList(bm, w, LIST_FORMAT_DOTTED) }},
+		{"lines", func(w io.Writer) {
+			walkSegment(bm, 10, func(ip uint32) {
+				w.Write(append(appendIPv4(nil, ip), '\n'))
+			})
+		}},
+	}
+	for _, output := range outputs {
+		for _, buffered := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/buffered=%v", output.name, buffered), func(b *testing.B) {
+				for b.Loop() {
+					file.Truncate(0)
+					file.Seek(0, io.SeekStart)
+					if !buffered {
+						output.write(file)
+						continue
+					}
+					buffer := &bufferedStdout{w: bufio.NewWriterSize(file, STDOUT_BUFFER_SIZE)}
+					output.write(buffer)
+					buffer.flush()
+				}
+			})
+		}
+	}
+}
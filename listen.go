@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// Counting service: newline separated addresses from any number of connections go into one
+// live counter until SIGTERM/SIGINT. A "count" line is answered with the running count on the
+// same connection, SIGUSR1 prints it to stderr. Malformed lines are ignored.
+// With -flush-interval the count is also written out periodically
+func runListener(path string, counter *ConcurrentCounter) (uint64, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintln(os.Stderr, "Listening on", path)
+
+	live, stop := liveCounter(counter, config.FlushInterval)
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[*net.UnixConn]struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // listener closed
+			}
+
+			unixConn := conn.(*net.UnixConn)
+			mu.Lock()
+			conns[unixConn] = struct{}{}
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveConn(unixConn, live)
+
+				mu.Lock()
+				delete(conns, unixConn)
+				mu.Unlock()
+				unixConn.Close()
+			}()
+		}
+	}()
+
+	for sig := range signals {
+		if sig != syscall.SIGUSR1 {
+			break
+		}
+		fmt.Fprintln(os.Stderr, "Unique IP addresses amount: ", formatCount(live.Count()))
+	}
+
+	// Stop accepting (removes the socket file), then let every connection finish the lines it has
+	listener.Close()
+	mu.Lock()
+	for conn := range conns {
+		conn.CloseRead()
+	}
+	mu.Unlock()
+	wg.Wait()
+
+	return live.Count(), nil
+}
+
+func serveConn(conn *net.UnixConn, counter Counter) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if string(line) == "count" {
+			conn.Write(strconv.AppendUint(nil, counter.Count(), 10))
+			conn.Write([]byte{'\n'})
+			continue
+		}
+		if ip, ok := parseIPv4Strict(line, 0, len(line)); ok {
+			counter.Add(ip)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	MMAP_ADVISE_SEQUENTIAL = "sequential"
+	MMAP_ADVISE_RANDOM     = "random"
+	MMAP_ADVISE_NORMAL     = "normal"
+)
+
+func validateMmapAdvise(advise string) error {
+	switch advise {
+	case MMAP_ADVISE_SEQUENTIAL, MMAP_ADVISE_RANDOM, MMAP_ADVISE_NORMAL:
+		return nil
+	}
+	return errors.New("must be sequential, random or normal")
+}
+
+// Readahead hint for the mapped input. Only a hint: the kernel may ignore it,
+// and a failure never stops the run
+func adviseMmap(data []byte, advise string) {
+	switch advise {
+	case MMAP_ADVISE_SEQUENTIAL:
+		syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	case MMAP_ADVISE_RANDOM:
+		syscall.Madvise(data, syscall.MADV_RANDOM)
+	case MMAP_ADVISE_NORMAL:
+		syscall.Madvise(data, syscall.MADV_NORMAL)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Flag defaults and worker counts, every test starts from them
+var (
+	defaultConfig  Config
+	defaultWorkers = [3]int{WORKERS_AMOUNT, WORKERS_SUM_AMOUNT, WORKERS_MERGE_AMOUNT}
+)
+
+func TestMain(m *testing.M) {
+	defineFlags()
+	flag.Parse()
+	defaultConfig = config
+	os.Exit(m.Run())
+}
+
+// Default flags and no global state, restored again when the test ends
+func resetConfig(t testing.TB) {
+	t.Helper()
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+}
+
+func resetGlobals() {
+	config = defaultConfig
+	WORKERS_AMOUNT, WORKERS_SUM_AMOUNT, WORKERS_MERGE_AMOUNT = defaultWorkers[0], defaultWorkers[1], defaultWorkers[2]
+	bitmap, smallInputTally, progress, commitLog = nil, nil, nil, nil
+	filter, keyFn, heavyHitters, savedBaseline = nil, nil, nil, nil
+	groups, frequencies, rejects, resolver = nil, nil, nil, nil
+	manifestFiles, timedOutFiles, fileDuplicates = nil, nil, nil
+	longLines.Store(0)
+}
+
+// Fresh dense bitmap, outside the Go heap like in main, unmapped when the test ends
+func newTestBitmap(t testing.TB) *Bitmap {
+	t.Helper()
+	b, err := allocateBitmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { freeBitmap(b) })
+	return b
+}
+
+// Writes content into a file of the test's temp dir and returns its path
+func writeInput(t testing.TB, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync/atomic"
+)
+
+// -from0: NUL separated list of inputs, as `find -print0` writes it. Names may contain
+// anything but NUL, newlines included, and are taken as they are (no trimming)
+var manifestFiles []string
+
+// Files that went through processFiles completely, skipped ones (-deadline, -file-timeout) aren't
+var filesProcessed atomic.Uint64
+
+type ManifestResult struct {
+	Listed    int    `json:"listed"`
+	Processed uint64 `json:"processed"`
+}
+
+// Empty names (the trailing NUL, doubled separators) are skipped
+func readManifest0(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for name := range bytes.SplitSeq(data, []byte{0}) {
+		if len(name) > 0 {
+			files = append(files, string(name))
+		}
+	}
+	return files, nil
+}
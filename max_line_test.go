@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A multi-megabyte "line" without newlines is skipped, the lines around it still count
+func TestMaxLineLength(t *testing.T) {
+	blob := strings.Repeat("9", 5<<20)
+	data := []byte("10.0.0.1\n" + blob + "\n10.0.0.2\n10.0.0.1\n" + strings.Repeat("x", 3<<20))
+
+	paths := []struct {
+		name  string
+		count func(t *testing.T) uint64
+	}{
+		{"bitmap", func(t *testing.T) uint64 {
+			b := newTestBitmap(t)
+			countChunks(data, b)
+			return b.Count()
+		}},
+		{"counter", func(t *testing.T) uint64 {
+			counter := NewSparseSet()
+			countChunks(data, counter)
+			return counter.Count()
+		}},
+		{"single", func(t *testing.T) uint64 {
+			config.Single = true
+			b := newTestBitmap(t)
+			countChunks(data, b)
+			return b.Count()
+		}},
+		{"prefix", func(t *testing.T) uint64 {
+			counter := NewSparseSet()
+			processChunkPrefix(data, 0, len(data), counter, 10)
+			return counter.Count()
+		}},
+	}
+
+	for _, path := range paths {
+		t.Run(path.name, func(t *testing.T) {
+			resetConfig(t)
+			WORKERS_AMOUNT = 4
+
+			if count := path.count(t); count != 2 {
+				t.Errorf("count = %d, want 2", count)
+			}
+			if skipped := longLines.Load(); skipped != 2 {
+				t.Errorf("skipped %d long lines, want 2", skipped)
+			}
+		})
+	}
+
+	t.Run("checked", func(t *testing.T) {
+		resetConfig(t)
+		stats := &LineStats{}
+		counter := NewSparseSet()
+		processChunkChecked(data, task{end: len(data)}, counter, stats, nil)
+
+		if count := counter.Count(); count != 2 {
+			t.Errorf("count = %d, want 2", count)
+		}
+		if stats.TooLong != 2 || stats.Malformed != 2 || stats.Lines != 5 {
+			t.Errorf("too long %d, malformed %d, lines %d, want 2, 2 and 5", stats.TooLong, stats.Malformed, stats.Lines)
+		}
+	})
+}
+
+// Streamed input keeps only the start of a long line, blocks stay small and the line still counts as too long
+func TestMaxLineLengthReader(t *testing.T) {
+	blob := strings.Repeat("9", 9<<20) // over two blocks
+	data := []byte("10.0.0.1\n" + blob + "\n10.0.0.2\n10.0.0.1\n" + strings.Repeat("x", 3<<20))
+
+	for _, checked := range []bool{false, true} {
+		resetConfig(t)
+		WORKERS_AMOUNT = 2
+		counter := NewSparseSet()
+		stats := &LineStats{}
+		var mu sync.Mutex
+		biggest := 0
+
+		err := processReader(bytes.NewReader(data), func(data []byte, chunk task) {
+			local := &LineStats{}
+			if checked {
+				processChunkChecked(data, chunk, counter, local, nil)
+			} else {
+				processChunk(data, chunk.start, chunk.end, counter)
+			}
+			mu.Lock()
+			biggest = max(biggest, len(data))
+			stats.add(local)
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		skipped := longLines.Load()
+		if checked {
+			skipped = stats.TooLong
+		}
+		if count := counter.Count(); count != 2 || skipped != 2 {
+			t.Errorf("checked %v: count %d, %d too long, want 2 and 2", checked, count, skipped)
+		}
+		if checked && stats.Lines != 5 {
+			t.Errorf("%d lines, want 5", stats.Lines)
+		}
+		if limit := READER_BLOCK_SIZE + config.MaxLineLength + 1; biggest > limit {
+			t.Errorf("checked %v: block of %d bytes, want at most %d", checked, biggest, limit)
+		}
+	}
+}
+
+// Chunked like processMapped does it
+func countChunks(data []byte, counter Counter) {
+	offsets := getChunkOffsets(data)
+	for i := range len(offsets) - 1 {
+		processChunk(data, offsets[i], offsets[i+1], counter)
+	}
+}
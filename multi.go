@@ -0,0 +1,62 @@
+package main
+
+import "sync/atomic"
+
+// Lines vs addresses of -multi-per-line
+type TokenStats struct {
+	Lines     uint64 `json:"lines"`
+	Addresses uint64 `json:"addresses"`
+	Invalid   uint64 `json:"invalid"` // tokens that aren't addresses
+}
+
+var tokenStats struct {
+	lines, addresses, invalid atomic.Uint64
+}
+
+// Every whitespace separated token of a line is an address of its own (route next-hops etc).
+// Lines are still found by '\n', so chunk boundaries stay safe. Invalid tokens are skipped
+func processChunkMulti(data []byte, start, end int, counter Counter) {
+	var lines, addresses, invalid uint64
+
+	lineStart := start
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+		if !isBlankLine(data, lineStart, i) {
+			lines++
+		}
+
+		for tokenStart := lineStart; tokenStart < i; {
+			if isSpace(data[tokenStart]) {
+				tokenStart++
+				continue
+			}
+			tokenEnd := tokenStart
+			for tokenEnd < i && !isSpace(data[tokenEnd]) {
+				tokenEnd++
+			}
+
+			if ip, ok := parseIPv4Strict(data, tokenStart, tokenEnd); ok {
+				counter.Add(ip)
+				addresses++
+			} else {
+				invalid++
+			}
+			tokenStart = tokenEnd
+		}
+		lineStart = i + 1
+	}
+
+	tokenStats.lines.Add(lines)
+	tokenStats.addresses.Add(addresses)
+	tokenStats.invalid.Add(invalid)
+}
+
+func getTokenStats() *TokenStats {
+	return &TokenStats{
+		Lines:     tokenStats.lines.Load(),
+		Addresses: tokenStats.addresses.Load(),
+		Invalid:   tokenStats.invalid.Load(),
+	}
+}
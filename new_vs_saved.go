@@ -0,0 +1,21 @@
+package main
+
+// -count-new-vs-saved: addresses of a saved bitmap are dropped before they reach the counter,
+// so the count is directly the amount of new ones. Unlike -baseline there is no AndNot and
+// no second Count over the result, and the backend may be sparse or hll
+var savedBaseline *Bitmap
+
+type newVsSavedCounter struct {
+	inner Counter
+	saved *Bitmap
+}
+
+func (c *newVsSavedCounter) Add(ip uint32) {
+	if !c.saved.Contains(ip) {
+		c.inner.Add(ip)
+	}
+}
+
+func (c *newVsSavedCounter) Count() uint64 {
+	return c.inner.Count()
+}
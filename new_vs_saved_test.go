@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// Addresses of today with every second one already in the saved bitmap
+func newVsSavedInput(tb testing.TB, lines int) (string, *Bitmap) {
+	r := rand.New(rand.NewPCG(11, 12))
+	saved := newTestBitmap(tb)
+	var input strings.Builder
+	for i := range lines {
+		ip := r.Uint32() >> 8 // a /8 worth of addresses, so there are duplicates too
+		if i%2 == 0 {
+			saved.Add(ip)
+		}
+		fmt.Fprintf(&input, "%d.%d.%d.%d\n", ip>>24, ip>>16&0xFF, ip>>8&0xFF, ip&0xFF)
+	}
+	return writeInput(tb, "today.txt", input.String()), saved
+}
+
+// Dropping saved addresses on the way in counts the same as counting all and AndNot afterwards
+func TestNewVsSavedMatchesAndNot(t *testing.T) {
+	resetConfig(t)
+	filename, saved := newVsSavedInput(t, 50000)
+
+	all := newTestBitmap(t)
+	countUniqueIPs([]string{filename}, all)
+	all.AndNot(saved)
+	want := all.Count()
+
+	savedBaseline = saved
+	for _, counter := range []Counter{newTestBitmap(t), NewSparseSet()} {
+		if got := countUniqueIPs([]string{filename}, counter); got != want {
+			t.Errorf("%T: got %d new, AndNot gives %d", counter, got, want)
+		}
+	}
+}
+
+func BenchmarkNewVsSaved(b *testing.B) {
+	resetConfig(b)
+	filename, saved := newVsSavedInput(b, 1<<20)
+	counter := newTestBitmap(b)
+
+	b.Run("filter", func(b *testing.B) {
+		savedBaseline = saved
+		defer func() { savedBaseline = nil }()
+		for b.Loop() {
+			counter.Reset()
+			countUniqueIPs([]string{filename}, counter)
+		}
+	})
+	b.Run("and-not", func(b *testing.B) {
+		for b.Loop() {
+			counter.Reset()
+			countUniqueIPs([]string{filename}, counter)
+			counter.AndNot(saved)
+			counter.Count()
+		}
+	})
+}
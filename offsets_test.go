@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Where the proposed split of getChunkOffsets lands relative to a '\n'
+const (
+	splitOnNewline = iota
+	splitBeforeNewline
+	splitAfterNewline
+	splitInside
+)
+
+func classifySplit(data []byte, proposed int) int {
+	switch {
+	case data[proposed] == '\n':
+		return splitOnNewline
+	case proposed+1 < len(data) && data[proposed+1] == '\n':
+		return splitBeforeNewline
+	case proposed > 0 && data[proposed-1] == '\n':
+		return splitAfterNewline
+	}
+	return splitInside
+}
+
+// Lines of different widths and repeated addresses, n of them, with or without the last '\n'
+func boundaryInput(n int, trailingNewline bool) (string, int) {
+	var b strings.Builder
+	unique := map[string]bool{}
+	for i := range n {
+		ip := fmt.Sprintf("%d.%d.0.%d", 1+i%3*50, i%7, i*37%300%256)
+		unique[ip] = true
+		b.WriteString(ip)
+		if trailingNewline || i < n-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), len(unique)
+}
+
+// Chunks must partition the data exactly: a split on, just before or just after a '\n'
+// neither drops nor double-counts the line around it
+func TestChunkOffsetsBoundaries(t *testing.T) {
+	resetConfig(t)
+	seen := map[int]bool{}
+
+	for workers := 2; workers <= 5; workers++ {
+		WORKERS_AMOUNT = workers
+		for n := 1; n <= 40; n++ {
+			for _, trailing := range []bool{true, false} {
+				input, want := boundaryInput(n, trailing)
+				data := []byte(input)
+
+				chunkSize := (len(data) + workers - 1) / workers
+				for i := 1; i < workers && i*chunkSize < len(data); i++ {
+					seen[classifySplit(data, i*chunkSize)] = true
+				}
+
+				offsets := getChunkOffsets(data)
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							t.Fatalf("%d workers, %d lines: %v", workers, n, err)
+						}
+					}()
+					verifyChunkOffsets(data, offsets)
+				}()
+
+				counter := NewSparseSet()
+				for i := range len(offsets) - 1 {
+					processChunk(data, offsets[i], offsets[i+1], counter)
+				}
+				if count := counter.Count(); count != uint64(want) {
+					t.Errorf("%d workers, %d lines, trailing newline %v: count %d, want %d", workers, n, trailing, count, want)
+				}
+			}
+		}
+	}
+
+	for _, split := range []int{splitOnNewline, splitBeforeNewline, splitAfterNewline} {
+		if !seen[split] {
+			t.Errorf("no input split at case %d, the boundaries aren't covered", split)
+		}
+	}
+}
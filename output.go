@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const EXIT_EXPECT_MISMATCH = 3
+const EXIT_MALFORMED_THRESHOLD = 4
+
+// Everything we report after a run
+type Result struct {
+	Unique   uint64        `json:"unique"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	Expected *uint64       `json:"expected,omitempty"`
+	Match    *bool         `json:"match,omitempty"`
+	Pairs    *PairsResult  `json:"pairs,omitempty"`
+	Churn    *ChurnResult  `json:"churn,omitempty"`
+
+	Endpoints *EndpointsResult   `json:"endpoints,omitempty"`
+	Files     []FileContribution `json:"files,omitempty"`
+	Entries   uint64             `json:"archive_entries,omitempty"`
+	Benchmark *BenchmarkResult   `json:"benchmark,omitempty"`
+	ParseOnly *ParseOnlyResult   `json:"parse_only,omitempty"`
+
+	Confidence *ConfidenceInterval `json:"confidence,omitempty"` // estimator backends only
+	Tokens     *TokenStats         `json:"tokens,omitempty"`
+
+	EmptyShards []int             `json:"empty_shards,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Lines       *LineStats        `json:"lines,omitempty"`
+	Filtered    *FilterStats      `json:"filtered,omitempty"`
+	Resolve     *ResolveStats     `json:"resolve,omitempty"`
+	Range       *AddressRange     `json:"range,omitempty"`
+	Debug       *BitmapDebugStats `json:"debug,omitempty"`
+	Top         []TopEntry        `json:"top,omitempty"`
+	Groups      []GroupCount      `json:"groups,omitempty"`
+	IPv6        *IPv6Result       `json:"ipv6,omitempty"`
+	Combined    *CombinedResult   `json:"combined,omitempty"`
+
+	HeavyHitters []HeavyHitterEntry `json:"heavy_hitters,omitempty"`
+	Appended     *AppendResult      `json:"appended,omitempty"`
+
+	NewSinceBaseline *uint64 `json:"new_since_baseline,omitempty"`
+	HeadBytes        int64   `json:"head_bytes,omitempty"` // count is a sample of the first bytes
+
+	ShardBalance []ShardBalance `json:"shard_balance,omitempty"`
+	Chunks       []ChunkProfile `json:"chunks,omitempty"`
+
+	ThresholdExceeded bool `json:"threshold_exceeded,omitempty"`
+	TimedOut          bool `json:"timed_out,omitempty"` // -deadline passed, counts are partial
+
+	TimedOutFiles []string        `json:"timed_out_files,omitempty"` // skipped by -file-timeout, not in the count
+	LongLines     uint64          `json:"long_lines,omitempty"`      // over -max-line-length, skipped without line stats
+	Manifest      *ManifestResult `json:"manifest,omitempty"`        // -from0, processed counts files of the command line and -fd too
+
+	FileDuplicates []FileDuplicates `json:"file_duplicates,omitempty"` // -per-file-dups
+}
+
+func (r *Result) checkExpected(expected *uint64) {
+	if expected == nil {
+		return
+	}
+
+	match := r.Unique == *expected
+	r.Expected = expected
+	r.Match = &match
+}
+
+// threshold < 0 means disabled
+func (r *Result) checkMalformedThreshold(threshold float64) {
+	if threshold < 0 || r.Lines == nil {
+		return
+	}
+	r.ThresholdExceeded = r.Lines.MalformedRate > threshold
+}
+
+func printResult(w io.Writer, r Result) {
+	if config.JSON {
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(r); err != nil {
+			panic(err.Error())
+		}
+	} else if config.Template != nil {
+		var buf bytes.Buffer
+		if err := config.Template.Execute(&buf, r); err != nil {
+			fatal(fmt.Errorf("-template: %w", err))
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte{'\n'}) {
+			buf.WriteByte('\n')
+		}
+		w.Write(buf.Bytes())
+	} else {
+		if r.Pairs != nil {
+			fmt.Fprintln(w, "Unique pairs amount: ", formatCount(r.Pairs.Pairs))
+			fmt.Fprintln(w, "Unique sources amount: ", formatCount(r.Pairs.Src))
+			fmt.Fprintln(w, "Unique destinations amount: ", formatCount(r.Pairs.Dst))
+		} else if r.Endpoints != nil {
+			fmt.Fprintln(w, "Unique endpoints amount: ", formatCount(r.Endpoints.Endpoints))
+			fmt.Fprintln(w, "Unique IP addresses amount: ", formatCount(r.Endpoints.IPs))
+			fmt.Fprintln(w, "Unique ports amount: ", formatCount(r.Endpoints.Ports))
+			fmt.Fprintln(w, "Malformed lines: ", formatCount(r.Endpoints.Malformed))
+		} else if r.ParseOnly != nil {
+			fmt.Fprintf(w, "Parse only: %s lines in %v, %s lines/s (%.1f MB/s)\n", formatCount(r.ParseOnly.Lines),
+				r.ParseOnly.Elapsed, formatCount(uint64(r.ParseOnly.LinesPerSecond)), r.ParseOnly.MBPerSecond)
+		} else if config.NewVsSaved == "" {
+			fmt.Fprintln(w, "Unique IP addresses amount: ", formatCount(r.Unique))
+		}
+		if r.Confidence != nil {
+			fmt.Fprintf(w, "Estimated %s ± %s (%g%%)\n", formatCount(r.Unique), formatCount(r.Confidence.Margin), r.Confidence.Level*100)
+		}
+		if r.Churn != nil {
+			fmt.Fprintf(w, "Churn: added %s, removed %s, retained %s, Jaccard %.4f\n",
+				formatCount(r.Churn.Added), formatCount(r.Churn.Removed), formatCount(r.Churn.Retained), r.Churn.Jaccard)
+		}
+		if r.IPv6 != nil {
+			fmt.Fprintln(w, "Unique IPv6 hosts amount: ", formatCount(r.IPv6.Hosts))
+			fmt.Fprintln(w, "Unique IPv6 /64 networks amount: ", formatCount(r.IPv6.Networks64))
+		}
+		if r.Combined != nil {
+			fmt.Fprintf(w, "Unique addresses (IPv4 + IPv6): %s (IPv4 %s, IPv6 %s, IPv4-mapped lines %s)\n",
+				formatCount(r.Combined.Total), formatCount(r.Combined.IPv4), formatCount(r.Combined.IPv6), formatCount(r.IPv6.Mapped))
+		}
+		if r.Tokens != nil {
+			fmt.Fprintf(w, "Addresses: %s in %s lines (invalid tokens: %s)\n",
+				formatCount(r.Tokens.Addresses), formatCount(r.Tokens.Lines), formatCount(r.Tokens.Invalid))
+		}
+		if r.Entries > 0 {
+			fmt.Fprintln(w, "Archive entries: ", formatCount(r.Entries))
+		}
+		if r.HeadBytes > 0 {
+			fmt.Fprintf(w, "Sample: first %s bytes of every input only\n", formatCount(uint64(r.HeadBytes)))
+		}
+		if r.Appended != nil {
+			fmt.Fprintln(w, "New unique addresses: ", formatCount(r.Appended.New))
+			fmt.Fprintln(w, "Cumulative unique addresses: ", formatCount(r.Appended.Cumulative))
+		}
+		if r.NewSinceBaseline != nil {
+			fmt.Fprintln(w, "New since baseline: ", formatCount(*r.NewSinceBaseline))
+		}
+		if r.Lines != nil && config.Stats {
+			fmt.Fprintln(w, "Lines: ", formatCount(r.Lines.Lines))
+			fmt.Fprintln(w, "Malformed lines: ", formatCount(r.Lines.Malformed))
+			fmt.Fprintf(w, "Malformed rate: %.4f%%\n", r.Lines.MalformedRate*100)
+			if r.Lines.TooLong > 0 {
+				fmt.Fprintln(w, "Lines over -max-line-length: ", formatCount(r.Lines.TooLong))
+			}
+			if len(r.Lines.Examples) > 0 {
+				fmt.Fprintf(w, "First %d malformed lines:\n", len(r.Lines.Examples))
+				for _, example := range r.Lines.Examples {
+					fmt.Fprintf(w, "  %d\t%q\n", example.Line, example.Content)
+				}
+			}
+		}
+		if r.Lines != nil && (config.Stats || config.Families) {
+			fmt.Fprintf(w, "ipv4: %s  ipv6: %s  other: %s\n",
+				formatCount(r.Lines.IPv4), formatCount(r.Lines.IPv6), formatCount(r.Lines.Other))
+		}
+		if r.Resolve != nil {
+			fmt.Fprintf(w, "Hostnames: %s resolved, %s failed (%s addresses)\n",
+				formatCount(r.Resolve.Resolved), formatCount(r.Resolve.Failed), formatCount(r.Resolve.Addresses))
+		}
+		if r.Range != nil {
+			fmt.Fprintf(w, "Address range: %s - %s (span %s)\n", r.Range.Min, r.Range.Max, formatCount(uint64(r.Range.Span)))
+		}
+		if r.EmptyShards != nil && len(r.EmptyShards) == 0 {
+			fmt.Fprintln(w, "empty /8: none")
+		} else if r.EmptyShards != nil {
+			fmt.Fprintln(w, "empty /8:", formatOctetRanges(r.EmptyShards))
+		}
+		if r.Fingerprint != "" {
+			fmt.Fprintln(w, "Fingerprint: ", r.Fingerprint)
+		}
+		if r.Filtered != nil {
+			fmt.Fprintln(w, "Filtered by allowlist: ", formatCount(r.Filtered.NotAllowed))
+			fmt.Fprintln(w, "Filtered by blocklist: ", formatCount(r.Filtered.Blocked))
+		}
+		if len(r.Top) > 0 {
+			fmt.Fprintln(w, "Top addresses:")
+			for _, entry := range r.Top {
+				fmt.Fprintf(w, "  %s\t%s", formatCount(entry.Count), entry.Address)
+				if len(entry.Lines) > 0 {
+					fmt.Fprintf(w, "\tlines %s", formatLines(entry.Lines))
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		if len(r.FileDuplicates) > 0 {
+			fmt.Fprintln(w, "Duplicates within files:")
+			for _, file := range r.FileDuplicates {
+				fmt.Fprintf(w, "  %s\tlines %s\tdistinct %s\tduplicate rate %.2f%%\n",
+					file.File, formatCount(file.Lines), formatCount(file.Distinct), file.DuplicateRate*100)
+			}
+		}
+		if r.Manifest != nil {
+			fmt.Fprintf(w, "Files: %d listed, %d processed\n", r.Manifest.Listed, r.Manifest.Processed)
+		}
+		if len(r.Groups) > 0 {
+			fmt.Fprintln(w, "Unique per group:")
+			for _, group := range r.Groups {
+				fmt.Fprintf(w, "  %s\t%s\n", formatCount(group.Unique), group.Group)
+			}
+		}
+		if len(r.HeavyHitters) > 0 {
+			fmt.Fprintln(w, "Heavy hitters (count may be over by error):")
+			for _, entry := range r.HeavyHitters {
+				fmt.Fprintf(w, "  %s\t%s\terror %s\n", formatCount(entry.Count), entry.Address, formatCount(entry.Error))
+			}
+		}
+		if r.Benchmark != nil {
+			printBenchmark(w, r.Benchmark)
+		}
+		if r.Debug != nil {
+			fmt.Fprintf(w, "Debug: set bits %d, unset bits %d, empty /8 shards %d, full /8 shards %d\n",
+				r.Debug.SetBits, r.Debug.UnsetBits, r.Debug.EmptyShards, r.Debug.FullShards)
+		}
+		if len(r.Chunks) > 0 {
+			fmt.Fprintln(w, "Debug: chunks")
+			for _, chunk := range r.Chunks {
+				fmt.Fprintf(w, "  %s #%d\tbytes %d-%d\tlines %s\t%v\n",
+					chunk.File, chunk.Chunk, chunk.Start, chunk.End, formatCount(uint64(chunk.Lines)), chunk.Elapsed)
+			}
+		}
+		for _, balance := range r.ShardBalance {
+			fmt.Fprintf(w, "Debug: %s shards min %d, max %d, mean %.1f, stddev %.1f\n",
+				balance.Map, balance.Min, balance.Max, balance.Mean, balance.StdDev)
+		}
+		fmt.Fprintln(w, "Time elapsed: ", r.Elapsed)
+	}
+
+	if r.TimedOut {
+		fmt.Fprintf(os.Stderr, "Timed out: -deadline %v passed, counts are partial\n", config.Deadline)
+	}
+	for _, filename := range r.TimedOutFiles {
+		fmt.Fprintf(os.Stderr, "Timed out: %s took over -file-timeout %v, skipped\n", filename, config.FileTimeout)
+	}
+
+	if r.LongLines > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %s lines over -max-line-length %d\n", formatCount(r.LongLines), config.MaxLineLength)
+	}
+
+	if r.ThresholdExceeded {
+		fmt.Fprintf(os.Stderr, "Warning: malformed lines rate %.4f%% exceeds threshold %.4f%%\n",
+			r.Lines.MalformedRate*100, config.WarnThreshold*100)
+	}
+
+	if r.Match != nil && !*r.Match {
+		fmt.Fprintf(os.Stderr, "Unique count mismatch: expected %d, got %d\n", *r.Expected, r.Unique)
+	}
+}
+
+// -template is parsed at startup, so a typo fails before the (possibly long) run, not after it.
+// count is formatCount, e.g. {{count .Unique}} honours -human
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("result").Funcs(template.FuncMap{"count": formatCount}).Parse(text)
+}
+
+// JSON always gets raw numbers, grouping is only for humans
+func formatCount(n uint64) string {
+	if config.Human {
+		return formatGrouped(n)
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+func formatLines(lines []uint64) string {
+	buf := make([]byte, 0, len(lines)*8)
+	for i, line := range lines {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = strconv.AppendUint(buf, line, 10)
+	}
+	return string(buf)
+}
+
+// Clear message for user facing errors instead of a panic trace
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	exit(1)
+}
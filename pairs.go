@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Distinct (src, dst) pairs plus distinct sources and destinations on their own
+type PairsResult struct {
+	Pairs uint64 `json:"pairs"`
+	Src   uint64 `json:"src"`
+	Dst   uint64 `json:"dst"`
+}
+
+type pairCounter struct {
+	pairs *ShardedSet[uint64]
+	src   *Bitmap
+	dst   *Bitmap
+}
+
+// "1,2" -> 1-based columns of source and destination
+func parsePairColumns(value string) ([2]int, error) {
+	var columns [2]int
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return columns, fmt.Errorf("expected two columns like 1,2, got %q", value)
+	}
+
+	for i, part := range parts {
+		column, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || column < 1 {
+			return columns, fmt.Errorf("invalid column %q", part)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+func (c *pairCounter) processChunk(data []byte, start, end int, columns [2]int) {
+	lineStart := start
+
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+
+		if i > lineStart {
+			c.processLine(data, lineStart, i, columns)
+		}
+		lineStart = i + 1
+	}
+}
+
+// Lines without both columns are skipped
+func (c *pairCounter) processLine(data []byte, start, end int, columns [2]int) {
+	srcStart, srcEnd, ok := getField(data, start, end, columns[0], config.FieldSep)
+	if !ok {
+		return
+	}
+	dstStart, dstEnd, ok := getField(data, start, end, columns[1], config.FieldSep)
+	if !ok {
+		return
+	}
+
+	srcFirst, srcRest := parseIPv4(data, srcStart, srcEnd)
+	dstFirst, dstRest := parseIPv4(data, dstStart, dstEnd)
+	src := uint32(srcFirst)<<24 | srcRest
+	dst := uint32(dstFirst)<<24 | dstRest
+
+	c.src.Add(src)
+	c.dst.Add(dst)
+	c.pairs.Add(uint64(src)<<32 | uint64(dst))
+}
+
+// Needs two dense bitmaps (1 GB) plus the pair set
+func countUniquePairs(filenames []string, columns [2]int) PairsResult {
+	dst, err := allocateBitmap()
+	if err != nil {
+		fatal(err)
+	}
+	counter := &pairCounter{pairs: NewShardedSet(shardIndex), src: bitmap, dst: dst}
+	pairSet = counter.pairs
+
+	processFiles(filenames, func(data []byte, chunk task) {
+		counter.processChunk(data, chunk.start, chunk.end, columns)
+	})
+
+	return PairsResult{
+		Pairs: counter.pairs.Count(),
+		Src:   counter.src.Count(),
+		Dst:   counter.dst.Count(),
+	}
+}
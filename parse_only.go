@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// -parse-only: the whole chunk and line pipeline with parseIPv4 on every line, but no bitmap.
+// Parsed addresses are XORed into a global, so the compiler can't drop the parsing
+type ParseOnlyResult struct {
+	Lines          uint64        `json:"lines"`
+	Bytes          uint64        `json:"bytes"`
+	Elapsed        time.Duration `json:"elapsed_ns"`
+	LinesPerSecond float64       `json:"lines_per_second"`
+	MBPerSecond    float64       `json:"mb_per_second"`
+}
+
+var parseSink atomic.Uint32
+
+func runParseOnly(filenames []string) *ParseOnlyResult {
+	var lines, bytes atomic.Uint64
+
+	startTime := time.Now()
+	processFiles(filenames, func(data []byte, chunk task) {
+		chunkLines, sink := processChunkParseOnly(data, chunk.start, chunk.end)
+		lines.Add(chunkLines)
+		bytes.Add(uint64(chunk.end - chunk.start))
+		parseSink.Store(parseSink.Load() ^ sink)
+	})
+	elapsed := time.Since(startTime)
+
+	result := &ParseOnlyResult{Lines: lines.Load(), Bytes: bytes.Load(), Elapsed: elapsed}
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		result.LinesPerSecond = float64(result.Lines) / seconds
+		result.MBPerSecond = float64(result.Bytes) / seconds / (1 << 20)
+	}
+	return result
+}
+
+// Same loop as processChunkBitmap, with the bit write replaced by the sink
+func processChunkParseOnly(data []byte, start, end int) (uint64, uint32) {
+	lineStart := start
+	maxLine := config.lineLengthLimit()
+	lines := uint64(0)
+	sink := uint32(0)
+
+	for i := start; i < end; i++ {
+		if data[i] == '\n' {
+			if i-lineStart <= maxLine {
+				first, rest := parseIPv4(data, lineStart, i)
+				sink ^= uint32(first)<<24 | rest
+			}
+			lines++
+			lineStart = i + 1
+			i += 7 // skip forward
+		}
+	}
+
+	if lineStart < end && end-lineStart <= maxLine {
+		first, rest := parseIPv4(data, lineStart, end)
+		sink ^= uint32(first)<<24 | rest
+		lines++
+	}
+	return lines, sink
+}
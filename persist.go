@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Saved bitmap: 8 byte magic, checksum (uint32), then all segments as little endian uint64 (512 MB).
+// Files of the first version have no checksum and are still loaded, just unverified
+const BITMAP_FILE_MAGIC = "IPV4BMP2"
+const BITMAP_FILE_MAGIC_V1 = "IPV4BMP1"
+const BITMAP_FILE_HEADER_SIZE = len(BITMAP_FILE_MAGIC) + 4
+const BITMAP_FILE_SIZE = int64(BITMAP_FILE_HEADER_SIZE) + OCTET_MAX_VALUE*BITMAP_SEGMENT_SIZE*8
+const BITMAP_FILE_SIZE_V1 = int64(len(BITMAP_FILE_MAGIC_V1)) + OCTET_MAX_VALUE*BITMAP_SEGMENT_SIZE*8
+
+var errNotSavedBitmap = errors.New("not a saved bitmap")
+var errBitmapChecksum = errors.New("checksum mismatch, the file is corrupted")
+var errNoChecksum = errors.New("saved without a checksum")
+
+var CRC32C = crc32.MakeTable(crc32.Castagnoli)
+
+// CRC-32C over the CRC-32C of every encoded segment in /8 order, so segments can be summed in parallel
+func combineChecksums(sums *[OCTET_MAX_VALUE]uint32) uint32 {
+	buf := make([]byte, 0, OCTET_MAX_VALUE*4)
+	for _, sum := range sums {
+		buf = binary.LittleEndian.AppendUint32(buf, sum)
+	}
+	return crc32.Checksum(buf, CRC32C)
+}
+
+// Checksum of the bitmap as it's written by -save
+func (b *Bitmap) Checksum() uint32 {
+	var sums [OCTET_MAX_VALUE]uint32
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		buf := make([]byte, BITMAP_SEGMENT_SIZE*8)
+		for i := t.start; i < t.end; i++ {
+			for j, word := range &b.segments[i] {
+				binary.LittleEndian.PutUint64(buf[j*8:], word)
+			}
+			sums[i] = crc32.Checksum(buf, CRC32C)
+		}
+	})
+	return combineChecksums(&sums)
+}
+
+func SaveBitmap(bitmap *Bitmap, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeBitmap(file, bitmap); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Writes through a shared mapping of the file when possible: segments are encoded straight
+// into the page cache in parallel, without the buffered writer and its copies.
+// Anything that can't be mapped (pipes, /dev/stdout) gets the buffered write
+func writeBitmap(file *os.File, bitmap *Bitmap) error {
+	if err := writeBitmapMapped(file, bitmap); err == nil {
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeBitmapBuffered(file, bitmap)
+}
+
+func writeBitmapMapped(file *os.File, bitmap *Bitmap) error {
+	if err := preallocate(file, BITMAP_FILE_SIZE); err != nil {
+		return err
+	}
+	data, err := mmapRetry(int(file.Fd()), 0, int(BITMAP_FILE_SIZE), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer munmapRetry(data)
+
+	var sums [OCTET_MAX_VALUE]uint32
+	copy(data, BITMAP_FILE_MAGIC)
+	segments := data[BITMAP_FILE_HEADER_SIZE:]
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			segment := segments[i*BITMAP_SEGMENT_SIZE*8 : (i+1)*BITMAP_SEGMENT_SIZE*8]
+			for j, word := range &bitmap.segments[i] {
+				binary.LittleEndian.PutUint64(segment[j*8:], word)
+			}
+			sums[i] = crc32.Checksum(segment, CRC32C)
+		}
+	})
+	binary.LittleEndian.PutUint32(data[len(BITMAP_FILE_MAGIC):], combineChecksums(&sums))
+	return nil
+}
+
+func writeBitmapBuffered(file *os.File, bitmap *Bitmap) error {
+	// Checksum goes first, so it's one more pass over the bitmap
+	writer := bufio.NewWriterSize(file, 1<<20)
+	if _, err := writer.WriteString(BITMAP_FILE_MAGIC); err != nil {
+		return err
+	}
+	if err := binary.Write(writer, binary.LittleEndian, bitmap.Checksum()); err != nil {
+		return err
+	}
+
+	buf := make([]byte, BITMAP_SEGMENT_SIZE*8)
+	for i := range bitmap.segments {
+		for j, word := range &bitmap.segments[i] {
+			binary.LittleEndian.PutUint64(buf[j*8:], word)
+		}
+		if _, err := writer.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Loaded into an mmapped bitmap like the main one, too little memory is an error, not a crash
+func LoadBitmap(filename string) (*Bitmap, error) {
+	bitmap, err := allocateBitmap()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := loadBitmapInto(bitmap, filename); err != nil {
+		freeBitmap(bitmap)
+		return nil, err
+	}
+	return bitmap, nil
+}
+
+// Overwrites every segment of bitmap with the saved one, dense or compact (detected by magic).
+// A dense file whose checksum doesn't match fails with errBitmapChecksum
+func loadBitmapInto(bitmap *Bitmap, filename string) error {
+	_, err := loadBitmapChecked(bitmap, filename)
+	return err
+}
+
+// Same as loadBitmapInto, also tells if there was a checksum to verify
+func loadBitmapChecked(bitmap *Bitmap, filename string) (verified bool, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	magic := make([]byte, len(BITMAP_FILE_MAGIC))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false, fmt.Errorf("%s: %w (bad magic)", filename, errNotSavedBitmap)
+	}
+	if string(magic) == BITMAP_COMPACT_MAGIC || string(magic) == BITMAP_COMPACT_MAGIC_V1 {
+		verified = string(magic) == BITMAP_COMPACT_MAGIC
+		if err := readBitmapCompact(bitmap, file, fileInfo.Size()-int64(len(magic)), verified); err != nil {
+			return false, fmt.Errorf("%s: %w", filename, err)
+		}
+		return verified, nil
+	}
+
+	expectedSize := BITMAP_FILE_SIZE
+	if string(magic) == BITMAP_FILE_MAGIC_V1 {
+		expectedSize = BITMAP_FILE_SIZE_V1
+	} else if string(magic) != BITMAP_FILE_MAGIC {
+		return false, fmt.Errorf("%s: %w (bad magic)", filename, errNotSavedBitmap)
+	}
+	if fileInfo.Size() != expectedSize {
+		return false, fmt.Errorf("%s: %w (size %d, expected %d)", filename, errNotSavedBitmap, fileInfo.Size(), expectedSize)
+	}
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	verified = string(magic) == BITMAP_FILE_MAGIC
+	var checksum uint32
+	if verified {
+		if err := binary.Read(reader, binary.LittleEndian, &checksum); err != nil {
+			return false, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	var sums [OCTET_MAX_VALUE]uint32
+	buf := make([]byte, BITMAP_SEGMENT_SIZE*8)
+	for i := range bitmap.segments {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return false, fmt.Errorf("%s: %w", filename, err)
+		}
+		if verified {
+			sums[i] = crc32.Checksum(buf, CRC32C)
+		}
+		for j := range bitmap.segments[i] {
+			bitmap.segments[i][j] = binary.LittleEndian.Uint64(buf[j*8:])
+		}
+	}
+
+	if verified && combineChecksums(&sums) != checksum {
+		return false, fmt.Errorf("%s: %w", filename, errBitmapChecksum)
+	}
+	return verified, nil
+}
+
+// -verify-checksum: loads every saved bitmap and reports whether it's intact.
+// Files without a checksum (first versions of both formats) fail, there's nothing to verify
+func verifySavedBitmaps(w io.Writer, filenames []string) bool {
+	scratch, err := allocateBitmap()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return false
+	}
+	defer freeBitmap(scratch)
+
+	ok := true
+	for _, filename := range filenames {
+		verified, err := loadBitmapChecked(scratch, filename)
+		if err == nil && !verified {
+			err = fmt.Errorf("%s: %w", filename, errNoChecksum)
+		}
+		if err != nil {
+			fmt.Fprintln(w, err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "%s: OK, %d addresses\n", filename, scratch.Count())
+	}
+	return ok
+}
+
+// MergeBitmaps of one src that also tells how many of its bits were new to dst
+func mergeNewBits(dst, src *Bitmap) uint64 {
+	var added [OCTET_MAX_VALUE]uint64
+	runWorkers(WORKERS_MERGE_AMOUNT, segmentTasks(WORKERS_MERGE_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			for j, word := range &src.segments[i] {
+				added[i] += uint64(bits.OnesCount64(word &^ dst.segments[i][j]))
+				dst.segments[i][j] |= word
+			}
+		}
+	})
+
+	total := uint64(0)
+	for _, n := range added {
+		total += n
+	}
+	return total
+}
+
+// ORs every src into dst, segments are split between WORKERS_MERGE_AMOUNT workers
+func MergeBitmaps(dst *Bitmap, srcs ...*Bitmap) {
+	runWorkers(WORKERS_MERGE_AMOUNT, segmentTasks(WORKERS_MERGE_AMOUNT), func(t task) {
+		for _, src := range srcs {
+			for i := t.start; i < t.end; i++ {
+				for j := range dst.segments[i] {
+					dst.segments[i][j] |= src.segments[i][j]
+				}
+			}
+		}
+	})
+}
+
+// Clears every bit of other in b: what b has and other doesn't
+func (b *Bitmap) AndNot(other *Bitmap) {
+	runWorkers(WORKERS_MERGE_AMOUNT, segmentTasks(WORKERS_MERGE_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			for j := range b.segments[i] {
+				b.segments[i][j] &^= other.segments[i][j]
+			}
+		}
+	})
+}
+
+// Reduce step: union of saved bitmaps without any text parsing.
+// One scratch bitmap is reused for loading, so peak memory is 1 GB for any amount of files
+func mergeSavedBitmaps(dst *Bitmap, filenames []string) error {
+	scratch, err := allocateBitmap()
+	if err != nil {
+		return err
+	}
+	defer freeBitmap(scratch)
+
+	for _, filename := range filenames {
+		if err := loadBitmapInto(scratch, filename); err != nil {
+			return err
+		}
+		MergeBitmaps(dst, scratch)
+	}
+	return nil
+}
+
+// Today's new addresses and the running total after -append-save
+type AppendResult struct {
+	New        uint64 `json:"new"`
+	Cumulative uint64 `json:"cumulative"`
+}
+
+// Running unique visitors: ORs bitmap into the saved one. A missing file is the first run (empty bitmap).
+// The result goes to a temp file next to it and is renamed over, so a crash never leaves a half written file
+func appendSaveBitmap(bitmap *Bitmap, filename string) (AppendResult, error) {
+	saved, err := allocateBitmap()
+	if err != nil {
+		return AppendResult{}, err
+	}
+	defer freeBitmap(saved)
+
+	if err := loadBitmapInto(saved, filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return AppendResult{}, err
+	}
+
+	var newBits [OCTET_MAX_VALUE]uint64
+	runWorkers(WORKERS_SUM_AMOUNT, segmentTasks(WORKERS_SUM_AMOUNT), func(t task) {
+		for i := t.start; i < t.end; i++ {
+			for j, word := range &bitmap.segments[i] {
+				newBits[i] += uint64(bits.OnesCount64(word &^ saved.segments[i][j]))
+			}
+		}
+	})
+	MergeBitmaps(saved, bitmap)
+
+	result := AppendResult{Cumulative: saved.Count()}
+	for _, n := range newBits {
+		result.New += n
+	}
+	return result, saveBitmapAtomic(saved, filename)
+}
+
+func saveBitmapAtomic(bitmap *Bitmap, filename string) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // no-op after the rename
+	defer file.Close()
+
+	if err := writeBitmap(file, bitmap); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
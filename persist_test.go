@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// Any flipped byte of a saved file, checksum included, fails the load and -verify-checksum
+func TestSavedBitmapChecksum(t *testing.T) {
+	formats := []struct {
+		name    string
+		save    func(*Bitmap, string) error
+		offsets func(size int64) []int64 // checksum, first and last segment byte
+	}{
+		{"dense", SaveBitmap, func(size int64) []int64 {
+			return []int64{int64(len(BITMAP_FILE_MAGIC)), int64(BITMAP_FILE_HEADER_SIZE), size - 1}
+		}},
+		{"compact", SaveBitmapCompact, func(size int64) []int64 {
+			return []int64{size - 1, int64(len(BITMAP_COMPACT_MAGIC)), size - 5}
+		}},
+	}
+
+	saved := newTestBitmap(t)
+	for _, ip := range []uint32{0, 0x0A000001, 0xC0A80101, 0xFFFFFFFF} {
+		saved.Add(ip)
+	}
+	loaded := newTestBitmap(t)
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "saved.bin")
+			if err := format.save(saved, filename); err != nil {
+				t.Fatal(err)
+			}
+			if err := loadBitmapInto(loaded, filename); err != nil || loaded.segments != saved.segments {
+				t.Fatalf("intact file: %v, same bits %v", err, loaded.segments == saved.segments)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, offset := range format.offsets(int64(len(data))) {
+				corrupted := filepath.Join(t.TempDir(), "corrupted.bin")
+				data[offset] ^= 0x10
+				err := os.WriteFile(corrupted, data, 0o644)
+				data[offset] ^= 0x10
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := loadBitmapInto(loaded, corrupted); !errors.Is(err, errBitmapChecksum) {
+					t.Errorf("byte %d flipped: got %v, want a checksum mismatch", offset, err)
+				}
+
+				var out strings.Builder
+				if verifySavedBitmaps(&out, []string{filename, corrupted}) {
+					t.Errorf("byte %d flipped: -verify-checksum passed", offset)
+				}
+				if !strings.Contains(out.String(), filename+": OK, 4 addresses") || !strings.Contains(out.String(), corrupted+": "+errBitmapChecksum.Error()) {
+					t.Errorf("byte %d flipped: got report %q", offset, out.String())
+				}
+				os.Remove(corrupted)
+			}
+		})
+	}
+}
+
+// A compact file of the first version has no checksum: it loads, but can't pass -verify-checksum
+func TestCompactV1Unverified(t *testing.T) {
+	saved := newTestBitmap(t)
+	saved.Add(0x0A000001)
+	filename := filepath.Join(t.TempDir(), "saved.bin")
+	if err := SaveBitmapCompact(saved, filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := append([]byte(BITMAP_COMPACT_MAGIC_V1), data[len(BITMAP_COMPACT_MAGIC):len(data)-4]...)
+	if err := os.WriteFile(filename, v1, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestBitmap(t)
+	if err := loadBitmapInto(loaded, filename); err != nil || loaded.segments != saved.segments {
+		t.Fatalf("got %v, same bits %v", err, loaded.segments == saved.segments)
+	}
+	var out strings.Builder
+	if verifySavedBitmaps(&out, []string{filename}) || !strings.Contains(out.String(), errNoChecksum.Error()) {
+		t.Errorf("got report %q, want %q", out.String(), errNoChecksum)
+	}
+}
+
+// Both ways of writing a saved bitmap give the same file
+func TestWriteBitmapMappedMatchesBuffered(t *testing.T) {
+	b := newTestBitmap(t)
+	for _, ip := range []uint32{1, 0x0A000001, 0xFFFFFFFF} {
+		b.Add(ip)
+	}
+
+	files := map[string]func(*os.File, *Bitmap) error{"mapped": writeBitmapMapped, "buffered": writeBitmapBuffered}
+	contents := map[string][]byte{}
+	for name, write := range files {
+		file, err := os.Create(filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(file, b); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		if contents[name], err = os.ReadFile(file.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if int64(len(contents["mapped"])) != BITMAP_FILE_SIZE || !bytes.Equal(contents["mapped"], contents["buffered"]) {
+		t.Errorf("mapped file of %d bytes, buffered %d, equal %v", len(contents["mapped"]), len(contents["buffered"]), bytes.Equal(contents["mapped"], contents["buffered"]))
+	}
+}
+
+// -save through the mapping vs the buffered writer: go test -bench SaveBitmap -benchtime 5x
+func BenchmarkSaveBitmap(b *testing.B) {
+	bitmap := newTestBitmap(b)
+	r := rand.New(rand.NewPCG(9, 10))
+	for range 1 << 20 {
+		bitmap.Add(r.Uint32())
+	}
+
+	for _, write := range []struct {
+		name string
+		fn   func(*os.File, *Bitmap) error
+	}{{"mapped", writeBitmapMapped}, {"buffered", writeBitmapBuffered}} {
+		b.Run(write.name, func(b *testing.B) {
+			filename := filepath.Join(b.TempDir(), "saved.bin")
+			b.SetBytes(BITMAP_FILE_SIZE)
+			for b.Loop() {
+				file, err := os.Create(filename)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := write.fn(file, bitmap); err != nil {
+					b.Fatal(err)
+				}
+				file.Close()
+			}
+		})
+	}
+}
+
+// Merge throughput by -merge-workers, it stops scaling once memory bandwidth is saturated:
+// go test -bench MergeBitmaps -benchtime 5x
+func BenchmarkMergeBitmaps(b *testing.B) {
+	dst, src := newTestBitmap(b), newTestBitmap(b)
+	r := rand.New(rand.NewPCG(15, 16))
+	for range 1 << 20 {
+		dst.Add(r.Uint32())
+		src.Add(r.Uint32())
+	}
+
+	workers := WORKERS_MERGE_AMOUNT
+	b.Cleanup(func() { WORKERS_MERGE_AMOUNT = workers })
+	for n := 1; n <= 2*runtime.NumCPU(); n *= 2 {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			WORKERS_MERGE_AMOUNT = n
+			b.SetBytes(2 * int64(unsafe.Sizeof(Bitmap{}))) // read and written
+			for b.Loop() {
+				MergeBitmaps(dst, src)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// cpu_set_t of the kernel, 1024 CPUs like glibc's
+type cpuSet [16]uint64
+
+// CPUs the process may run on (taskset, cgroup cpusets), worker i goes to the i-th of them
+var pinCPUs []int
+
+// The whole affinity mask, a worker's thread gets it back before it's unlocked
+var pinMask cpuSet
+
+var pinWarning sync.Once
+
+func initPinning() error {
+	var set cpuSet
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set))); errno != 0 {
+		return fmt.Errorf("-pin: %w", errno)
+	}
+	pinMask = set
+	for cpu := range len(set) * 64 {
+		if set[cpu/64]&(1<<(cpu%64)) != 0 {
+			pinCPUs = append(pinCPUs, cpu)
+		}
+	}
+	if len(pinCPUs) == 0 {
+		return errors.New("-pin: no CPUs in the affinity mask")
+	}
+	return nil
+}
+
+// Binds the calling worker to its own thread and that thread to one CPU, until the returned
+// unpin: the thread gets the whole mask back before it's unlocked, so it goes back to the
+// scheduler unpinned instead of being destroyed with the worker
+func pinWorker(worker int) (unpin func()) {
+	runtime.LockOSThread()
+
+	var set cpuSet
+	cpu := pinCPUs[worker%len(pinCPUs)]
+	set[cpu/64] |= 1 << (cpu % 64)
+	if errno := setAffinity(&set); errno != 0 {
+		pinWarning.Do(func() { fmt.Fprintln(os.Stderr, "Warning: -pin: can't pin to CPU", cpu, errno) })
+	}
+
+	return func() {
+		// A thread that can't be restored stays locked and exits with the worker, as it never was
+		if setAffinity(&pinMask) == 0 {
+			runtime.UnlockOSThread()
+		}
+	}
+}
+
+func setAffinity(set *cpuSet) syscall.Errno {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(*set), uintptr(unsafe.Pointer(set)))
+	return errno
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestPinRejectsParallelFiles(t *testing.T) {
+	resetConfig(t)
+	config.Pin = true
+	if err := validateConfig(); err != nil {
+		t.Fatalf("-pin alone: %v", err)
+	}
+	config.ParallelFiles = 2
+	if err := validateConfig(); err == nil {
+		t.Error("-pin with -parallel-files 2 passed validation")
+	}
+}
+
+// A worker is on its one CPU while it runs and its thread has the whole mask back afterwards
+func TestPinWorkerUnpins(t *testing.T) {
+	if err := initPinning(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pinCPUs = nil })
+
+	affinity := func() cpuSet {
+		var set cpuSet
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set))); errno != 0 {
+			t.Fatal(errno)
+		}
+		return set
+	}
+
+	// Locked around it too, so the checks run on the worker's thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	unpin := pinWorker(len(pinCPUs) - 1)
+	var want cpuSet
+	cpu := pinCPUs[len(pinCPUs)-1]
+	want[cpu/64] |= 1 << (cpu % 64)
+	if got := affinity(); got != want {
+		t.Errorf("pinned: mask %x, want only CPU %d", got, cpu)
+	}
+	unpin()
+	if got := affinity(); got != pinMask {
+		t.Errorf("unpinned: mask %x, want %x", got, pinMask)
+	}
+}
+
+// Same input with and without -pin: go test -bench Pin -cpu N
+func BenchmarkPin(b *testing.B) {
+	r := rand.New(rand.NewPCG(5, 6))
+	var input strings.Builder
+	for range 1 << 22 {
+		ip := r.Uint32()
+		fmt.Fprintf(&input, "%d.%d.%d.%d\n", ip>>24, ip>>16&0xFF, ip>>8&0xFF, ip&0xFF)
+	}
+	filename := writeInput(b, "pin.txt", input.String())
+	if err := initPinning(); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { pinCPUs = nil })
+
+	for _, pin := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pin=%v", pin), func(b *testing.B) {
+			resetConfig(b)
+			config.Pin = pin
+			counter := newTestBitmap(b)
+			b.SetBytes(int64(input.Len()))
+			for b.Loop() {
+				countUniqueIPs([]string{filename}, counter)
+			}
+		})
+	}
+}
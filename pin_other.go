@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// No sched_setaffinity, -pin does nothing
+func initPinning() error {
+	fmt.Fprintln(os.Stderr, "Warning: -pin works only on Linux, ignored")
+	return nil
+}
+
+func pinWorker(worker int) (unpin func()) { return func() {} }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Unit of work for the pool: byte range of the input or range of bitmap segments
+type task struct {
+	index int
+	start int
+	end   int
+	line  uint64 // 0-based number of the chunk's first line, only if line numbers were requested
+	file  int    // index of the chunk's input file, set by processFiles
+	data  []byte // own buffer of a reader block, nil for mmapped input
+}
+
+// Runs fn over tasks with n workers and waits until the channel is drained
+func runWorkers(n int, tasks <-chan task, fn func(task)) {
+	startWorkers(n, tasks, fn, false)
+}
+
+// runWorkers for the pools that parse chunks, the only ones -pin binds to CPUs: they run
+// for the whole input, the short segment and merge pools would only churn through threads
+func runChunkWorkers(n int, tasks <-chan task, fn func(task)) {
+	startWorkers(n, tasks, fn, config.Pin)
+}
+
+func startWorkers(n int, tasks <-chan task, fn func(task), pin bool) {
+	var wg sync.WaitGroup
+
+	wg.Add(n)
+	for w := 0; w < n; w++ {
+		go func() {
+			defer wg.Done()
+			if pin {
+				defer pinWorker(w)()
+			}
+			for t := range tasks {
+				fn(t)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// One task per [offsets[i], offsets[i+1]) range. lines may be nil
+func offsetTasks(offsets []int, lines []uint64) <-chan task {
+	tasks := make(chan task, len(offsets)-1)
+	for i := 0; i < len(offsets)-1; i++ {
+		t := task{index: i, start: offsets[i], end: offsets[i+1]}
+		if lines != nil {
+			t.line = lines[i]
+		}
+		tasks <- t
+	}
+	close(tasks)
+	return tasks
+}
+
+// Splits all bitmap segments into n equal ranges
+func segmentTasks(n int) <-chan task {
+	segmentsPerWorker := (OCTET_MAX_VALUE + n - 1) / n
+
+	tasks := make(chan task, n)
+	for i := 0; i < n; i++ {
+		start := min(i*segmentsPerWorker, OCTET_MAX_VALUE)
+		tasks <- task{index: i, start: start, end: min(start+segmentsPerWorker, OCTET_MAX_VALUE)}
+	}
+	close(tasks)
+	return tasks
+}
+
+// One task per /16 block in [first, last), index is relative to first
+func blockTasks(first, last int) <-chan task {
+	tasks := make(chan task, last-first)
+	for block := first; block < last; block++ {
+		tasks <- task{index: block - first, start: block, end: block + 1}
+	}
+	close(tasks)
+	return tasks
+}
+
+// Calls fn for pieces of about pieceBytes of chunk, cut after '\n', until fn returns false.
+// Pieces keep the chunk's index, and their own first line if line numbers were requested
+func forEachPiece(data []byte, chunk task, pieceBytes int, fn func(piece task) bool) {
+	piece := chunk
+	for piece.start < chunk.end {
+		piece.end = chunk.end
+		if piece.start+pieceBytes < chunk.end {
+			if idx := bytes.IndexByte(data[piece.start+pieceBytes:chunk.end], '\n'); idx >= 0 {
+				piece.end = piece.start + pieceBytes + idx + 1
+			}
+		}
+
+		if !fn(piece) {
+			return
+		}
+		if config.needsLineNumbers() {
+			piece.line += uint64(bytes.Count(data[piece.start:piece.end], []byte{'\n'}))
+		}
+		piece.start = piece.end
+	}
+}
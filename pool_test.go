@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Every task runs exactly once, on at most n workers at a time, and runWorkers returns after the last
+func TestRunWorkers(t *testing.T) {
+	for _, test := range []struct{ workers, tasks int }{{1, 10}, {4, 100}, {8, 3}, {3, 0}} {
+		tasks := make(chan task, test.tasks)
+		for i := range test.tasks {
+			tasks <- task{index: i}
+		}
+		close(tasks)
+
+		var mu sync.Mutex
+		runs := make([]int, test.tasks)
+		var running, peak atomic.Int64
+
+		runWorkers(test.workers, tasks, func(t task) {
+			now := running.Add(1)
+			for {
+				old := peak.Load()
+				if now <= old || peak.CompareAndSwap(old, now) {
+					break
+				}
+			}
+			mu.Lock()
+			runs[t.index]++
+			mu.Unlock()
+			running.Add(-1)
+		})
+
+		for i, n := range runs {
+			if n != 1 {
+				t.Errorf("%d workers, %d tasks: task %d ran %d times", test.workers, test.tasks, i, n)
+			}
+		}
+		if peak.Load() > int64(test.workers) {
+			t.Errorf("%d workers, %d tasks: %d ran at once", test.workers, test.tasks, peak.Load())
+		}
+	}
+}
+
+// Segment ranges cover all 256 segments exactly once, whatever the worker count
+func TestSegmentTasks(t *testing.T) {
+	for _, workers := range []int{1, 3, 7, 16, 255, 256, 300} {
+		var covered [OCTET_MAX_VALUE]int
+		for t := range segmentTasks(workers) {
+			for i := t.start; i < t.end; i++ {
+				covered[i]++
+			}
+		}
+		for i, n := range covered {
+			if n != 1 {
+				t.Fatalf("%d workers: segment %d covered %d times", workers, i, n)
+			}
+		}
+	}
+}
+
+// The pooled popcount equals a plain sequential one
+func TestCountBitsParallel(t *testing.T) {
+	resetConfig(t)
+	b := newTestBitmap(t)
+	for i := range uint32(5000) {
+		b.Add(i * 0x9E3779B1)
+	}
+	want := uint64(0)
+	for octet := range OCTET_MAX_VALUE {
+		want += countSegmentBits(b, octet)
+	}
+
+	for _, workers := range []int{1, 3, 8} {
+		WORKERS_SUM_AMOUNT = workers
+		if got := countBitsParallel(b); got != want {
+			t.Errorf("%d workers: %d, want %d", workers, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// Like processChunk, but only lines starting with "<prefix>." get parsed at all
+func processChunkPrefix(data []byte, start, end int, counter Counter, prefix byte) {
+	lineStart := start
+	maxLine := config.lineLengthLimit()
+
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+
+		if i-lineStart > maxLine {
+			longLines.Add(1)
+		} else if lineStart < i && firstOctetIs(data, lineStart, i, prefix) {
+			first, rest := parseIPv4(data, lineStart, i)
+			counter.Add(uint32(first)<<24 | rest)
+		}
+		lineStart = i + 1
+	}
+}
+
+// Looks at most at 4 bytes: up to 3 digits and the dot
+func firstOctetIs(data []byte, start, end int, prefix byte) bool {
+	octet := 0
+	for i := start; i < end && i < start+4; i++ {
+		if data[i] == '.' {
+			return i > start && octet == int(prefix)
+		}
+		if data[i] < '0' || data[i] > '9' {
+			return false
+		}
+		octet = octet*10 + int(data[i]-'0')
+	}
+	return false
+}
+
+// With -prefix only one segment of the dense bitmap can have bits, no need to count the rest
+func countCounter(counter Counter) uint64 {
+	if b, ok := counter.(*Bitmap); ok && config.Prefix >= 0 {
+		return countSegmentBits(b, config.Prefix)
+	}
+	if smallInputTally != nil {
+		return smallInputTally.Load()
+	}
+	return counter.Count()
+}
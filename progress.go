@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Workers report into shared counters once per batch, not per line
+const PROGRESS_BATCH = 1 << 16
+
+// Chunks are fed to workers in pieces of about this size, so bytes done move smoothly
+const PROGRESS_PIECE_BYTES = 4 << 20
+
+// Weight of the last second's throughput in the smoothed rate of the ETA
+const PROGRESS_RATE_ALPHA = 0.2
+
+const PROGRESS_BAR_WIDTH = 30
+
+const (
+	PROGRESS_PLAIN = "plain"
+	PROGRESS_ETA   = "eta"
+	PROGRESS_BAR   = "bar"
+)
+
+func validateProgressFormat(format string) error {
+	switch format {
+	case PROGRESS_PLAIN, PROGRESS_ETA, PROGRESS_BAR:
+		return nil
+	}
+	return errors.New("must be plain, eta or bar")
+}
+
+// Running "uniques so far / lines so far" while the file is being processed
+type Progress struct {
+	lines   atomic.Uint64
+	uniques atomic.Uint64
+	bytes   atomic.Uint64
+	total   uint64 // input size, 0 - unknown (pipes, URLs): no percent and ETA
+	done    chan struct{}
+	stopped chan struct{}
+
+	// Only touched by the printing goroutine
+	format    string
+	lastBytes uint64
+	lastTime  time.Time
+	rate      float64 // bytes per second, smoothed
+	width     int     // of the last printed line, for overwriting it
+	line      []byte
+}
+
+var progress *Progress
+
+func startProgress(interval time.Duration, format string, total uint64) *Progress {
+	p := &Progress{done: make(chan struct{}), stopped: make(chan struct{}), format: format, total: total, lastTime: time.Now()}
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.done:
+				p.print()
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *Progress) print() {
+	lines := p.lines.Load()
+	uniques := p.uniques.Load()
+
+	duplicates := 0.0
+	if lines > 0 {
+		duplicates = float64(lines-uniques) / float64(lines) * 100
+	}
+	// The line buffer is reused, printing allocates nothing while the workers run
+	line := p.line[:0]
+	stats := true
+	if p.total > 0 {
+		done := min(p.bytes.Load(), p.total)
+		percent := float64(done) / float64(p.total) * 100
+
+		switch p.format {
+		case PROGRESS_PLAIN:
+			line = fmt.Appendf(line, "%5.1f%%  ", percent)
+		case PROGRESS_ETA:
+			line = fmt.Appendf(line, "%5.1f%%  ETA %s  ", percent, p.eta(done))
+		case PROGRESS_BAR:
+			filled := int(percent / 100 * PROGRESS_BAR_WIDTH)
+			line = append(line, '[')
+			line = append(line, strings.Repeat("#", filled)...)
+			line = append(line, strings.Repeat("-", PROGRESS_BAR_WIDTH-filled)...)
+			line = fmt.Appendf(line, "] %5.1f%%  ETA %s", percent, p.eta(done))
+			stats = false
+		}
+	}
+	if stats {
+		line = append(line, "lines: "...)
+		line = appendGrouped(line, lines)
+		line = append(line, "  uniques: "...)
+		line = appendGrouped(line, uniques)
+		line = fmt.Appendf(line, "  duplicates: %.2f%%", duplicates)
+	}
+
+	// Spaces wipe the rest of a longer previous line
+	fmt.Fprintf(os.Stderr, "\r%-*s", p.width, line)
+	p.width = len(line)
+	p.line = line
+}
+
+// Remaining bytes over an exponential moving average of the throughput,
+// so one slow second (page cache miss, GC) doesn't make the ETA jump
+func (p *Progress) eta(done uint64) string {
+	now := time.Now()
+	if elapsed := now.Sub(p.lastTime).Seconds(); elapsed > 0 {
+		current := float64(done-p.lastBytes) / elapsed
+		if p.rate == 0 {
+			p.rate = current
+		} else {
+			p.rate = PROGRESS_RATE_ALPHA*current + (1-PROGRESS_RATE_ALPHA)*p.rate
+		}
+		p.lastBytes, p.lastTime = done, now
+	}
+
+	if done >= p.total {
+		return "0s"
+	}
+	if p.rate <= 0 {
+		return "?"
+	}
+	return time.Duration(float64(p.total-done) / p.rate * float64(time.Second)).Round(time.Second).String()
+}
+
+// Feeds a chunk to process in PROGRESS_PIECE_BYTES pieces and counts bytes done
+func progressChunks(process func(data []byte, chunk task)) func(data []byte, chunk task) {
+	return func(data []byte, chunk task) {
+		forEachPiece(data, chunk, PROGRESS_PIECE_BYTES, func(piece task) bool {
+			process(data, piece)
+			progress.bytes.Add(uint64(piece.end - piece.start))
+			return true
+		})
+	}
+}
+
+func (p *Progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
+
+// Per-worker view of the bitmap that also counts lines and 0->1 bit transitions.
+// A staged file's bitmap holds only that file, its transitions aren't global uniques:
+// staging reports the bits each file adds to the shared bitmap once it's merged
+type progressCounter struct {
+	bitmap   *Bitmap
+	progress *Progress
+	staged   bool
+	lines    uint64
+	uniques  uint64
+}
+
+func (c *progressCounter) Add(ip uint32) {
+	c.lines++
+	if c.bitmap.AddNew(ip) && !c.staged {
+		c.uniques++
+	}
+	if c.lines == PROGRESS_BATCH {
+		c.flush()
+	}
+}
+
+func (c *progressCounter) Count() uint64 {
+	return c.bitmap.Count()
+}
+
+func (c *progressCounter) flush() {
+	c.progress.lines.Add(c.lines)
+	c.progress.uniques.Add(c.uniques)
+	c.lines, c.uniques = 0, 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import "math/bits"
+
+// Smallest and largest seen address, derived from the bitmap
+type AddressRange struct {
+	Min  string `json:"min"`
+	Max  string `json:"max"`
+	Span uint32 `json:"span"`
+}
+
+// Lowest set bit: first non-empty segment, then first non-zero word
+func (b *Bitmap) Min() (uint32, bool) {
+	for octet := 0; octet < OCTET_MAX_VALUE; octet++ {
+		for wordIdx, word := range &b.segments[octet] {
+			if word != 0 {
+				return uint32(octet)<<24 | uint32(wordIdx)<<6 | uint32(bits.TrailingZeros64(word)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (b *Bitmap) Max() (uint32, bool) {
+	for octet := OCTET_MAX_VALUE - 1; octet >= 0; octet-- {
+		for wordIdx := BITMAP_SEGMENT_SIZE - 1; wordIdx >= 0; wordIdx-- {
+			if word := b.segments[octet][wordIdx]; word != 0 {
+				return uint32(octet)<<24 | uint32(wordIdx)<<6 | uint32(63-bits.LeadingZeros64(word)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// nil for an empty bitmap
+func getAddressRange(b *Bitmap) *AddressRange {
+	minIP, ok := b.Min()
+	if !ok {
+		return nil
+	}
+	maxIP, _ := b.Max()
+
+	return &AddressRange{
+		Min:  string(appendIPv4(nil, minIP)),
+		Max:  string(appendIPv4(nil, maxIP)),
+		Span: maxIP - minIP,
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const RAW_RECORD_SIZE = 4
+
+// Capture tool dumps: every address is a 4 byte record, no delimiters, nothing to parse
+func countUniqueRaw(filenames []string, counter Counter, littleEndian bool) uint64 {
+	for _, filename := range filenames {
+		data, closeFile := getMmapDataFromFilename(filename)
+
+		if len(data)%RAW_RECORD_SIZE != 0 {
+			closeFile()
+			fatal(fmt.Errorf("%s: size %d is not a multiple of %d byte records", filename, len(data), RAW_RECORD_SIZE))
+		}
+
+		records := len(data) / RAW_RECORD_SIZE
+		perWorker := (records + WORKERS_AMOUNT - 1) / WORKERS_AMOUNT
+		offsets := make([]int, WORKERS_AMOUNT+1)
+		for i := range offsets {
+			offsets[i] = min(i*perWorker, records) * RAW_RECORD_SIZE
+		}
+
+		runChunkWorkers(WORKERS_AMOUNT, offsetTasks(offsets, nil), func(t task) {
+			worker, done := workerCounter(counter)
+			processChunkRaw(data[t.start:t.end], worker, littleEndian)
+			done()
+		})
+		closeFile()
+	}
+
+	return countCounter(counter)
+}
+
+func processChunkRaw(data []byte, counter Counter, littleEndian bool) {
+	bitmap, dense := counter.(*Bitmap)
+
+	for i := 0; i+RAW_RECORD_SIZE <= len(data); i += RAW_RECORD_SIZE {
+		var ip uint32
+		if littleEndian {
+			ip = binary.LittleEndian.Uint32(data[i:])
+		} else {
+			ip = binary.BigEndian.Uint32(data[i:])
+		}
+
+		if dense {
+			setBitLocal(bitmap, byte(ip>>24), ip&0xFFFFFF)
+		} else {
+			counter.Add(ip)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// Reader input is cut into blocks of whole lines, every block is a task of its own
+const READER_BLOCK_SIZE = 4 << 20
+
+// Streaming counterpart of processFile for inputs that can't be mmapped (HTTP, pipes).
+// Blocks are handed to WORKERS_AMOUNT workers in order, with their global line numbers
+func processReader(r io.Reader, process func(data []byte, chunk task)) error {
+	tasks := make(chan task, WORKERS_AMOUNT)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		runChunkWorkers(WORKERS_AMOUNT, tasks, func(t task) {
+			process(t.data, t)
+		})
+	}()
+
+	if config.HeadBytes > 0 {
+		r = &io.LimitedReader{R: r, N: config.HeadBytes}
+	}
+
+	err := readBlocks(r, config.SkipHeader, func(t task) {
+		tasks <- t
+	})
+	close(tasks)
+	<-done
+	return err
+}
+
+// Calls emit with blocks ending on a line boundary, the last one may have no trailing '\n'.
+// Of a line over -max-line-length only the first limit+1 bytes are kept, the rest is dropped
+// up to its '\n': the line is still there to be counted as too long, but the carry stays small
+func readBlocks(r io.Reader, skipHeader int, emit func(task)) error {
+	first := true
+	var carry []byte
+	skipping := false // inside the dropped rest of a long line
+	index := 0
+	line := uint64(0)
+	maxLine := config.lineLengthLimit()
+
+	for {
+		// A pipe may never end, -deadline has to stop reading it too
+		if deadlineExpired.Load() {
+			return nil
+		}
+
+		block := make([]byte, len(carry), len(carry)+READER_BLOCK_SIZE)
+		copy(block, carry)
+
+		n, err := io.ReadFull(r, block[len(carry):cap(block)])
+		block = block[:len(carry)+n]
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		if skipping {
+			if idx := bytes.IndexByte(block[len(carry):], '\n'); idx >= 0 {
+				block = append(block[:len(carry)], block[len(carry)+idx:]...)
+				skipping = false
+			} else if block = block[:len(carry)]; !eof {
+				carry = block
+				continue
+			}
+		}
+
+		if first {
+			if block, err = stripBOM(block); err != nil {
+				return err
+			}
+			first = false
+		}
+
+		// Header lines can span several blocks
+		for skipHeader > 0 && len(block) > 0 {
+			idx := bytes.IndexByte(block, '\n')
+			if idx == -1 {
+				break
+			}
+			block = block[idx+1:]
+			skipHeader--
+		}
+
+		// Input cut by -head-bytes ends mid-line, the partial last line is dropped
+		end := len(block)
+		if limited, ok := r.(*io.LimitedReader); !eof || (ok && limited.N == 0) {
+			end = bytes.LastIndexByte(block, '\n') + 1
+		}
+		carry = block[end:]
+		if len(carry) > maxLine {
+			carry, skipping = carry[:maxLine+1], true
+		}
+
+		if skipHeader == 0 && end > 0 {
+			emit(task{index: index, start: 0, end: end, line: line, data: block[:end]})
+			index++
+			line += uint64(bytes.Count(block[:end], []byte{'\n'}))
+		} else if skipHeader > 0 {
+			// Nothing of a partial header line is needed, its '\n' in the next block ends it
+			carry, skipping = nil, false
+		}
+
+		if eof {
+			return nil
+		}
+	}
+}
+
+// Library entry point: counts newline separated addresses from any reader
+func CountUniqueFromReader(r io.Reader, counter Counter) (uint64, error) {
+	err := processReader(r, func(data []byte, chunk task) {
+		processChunk(data, chunk.start, chunk.end, counter)
+	})
+	return counter.Count(), err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// -reject-file: every malformed line as "<line number>\t<content>".
+// Workers collect their chunk's lines in a local buffer and hand it over per REJECT_FLUSH_SIZE
+// or at the chunk end, so the lock is not taken per line. Chunks finish in any order
+type rejectSink struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	err    error
+}
+
+var rejects *rejectSink
+
+// A mostly garbage chunk would otherwise hold all of its rejected lines until the chunk ends
+const REJECT_FLUSH_SIZE = 1 << 20
+
+func newRejectSink(filename string) (*rejectSink, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &rejectSink{file: file, writer: bufio.NewWriterSize(file, 1<<20)}, nil
+}
+
+func appendReject(buf []byte, line uint64, data []byte) []byte {
+	buf = strconv.AppendUint(buf, line, 10)
+	buf = append(buf, '\t')
+	buf = append(buf, data...)
+	return append(buf, '\n')
+}
+
+func (s *rejectSink) write(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		_, s.err = s.writer.Write(buf)
+	}
+}
+
+func (s *rejectSink) close() error {
+	if s.err != nil {
+		s.file.Close()
+		return s.err
+	}
+	if err := s.writer.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+const REPL_HELP = `Commands:
+  count                  unique addresses
+  contains 1.2.3.4       whether the address was seen
+  histogram              unique addresses per first octet
+  range 10.0.0.0/8       unique addresses inside the CIDR
+  quit`
+
+// Follow-up questions answered from the in-memory bitmap without reading the file again
+func runRepl(bitmap *Bitmap, in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(out, REPL_HELP)
+
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "count":
+			fmt.Fprintln(out, formatCount(bitmap.Count()))
+		case "contains":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: contains 1.2.3.4")
+				continue
+			}
+			addr, err := netip.ParseAddr(fields[1])
+			if err != nil || !addr.Is4() {
+				fmt.Fprintln(out, "not an IPv4 address:", fields[1])
+				continue
+			}
+			octets := addr.As4()
+			fmt.Fprintln(out, bitmap.Contains(uint32(octets[0])<<24|uint32(octets[1])<<16|uint32(octets[2])<<8|uint32(octets[3])))
+		case "histogram":
+			for octet, count := range getHistogram(bitmap) {
+				if count > 0 {
+					fmt.Fprintf(out, "%d.0.0.0/8\t%s\n", octet, formatCount(count))
+				}
+			}
+		case "range":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: range 10.0.0.0/8")
+				continue
+			}
+			first, last, err := parseCIDR(fields[1])
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			fmt.Fprintln(out, formatCount(countRange(bitmap, first, last)))
+		case "quit", "exit":
+			return
+		default:
+			fmt.Fprintln(out, REPL_HELP)
+		}
+	}
+}
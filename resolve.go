@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Lookups in flight at once, DNS is slow but shouldn't be hammered either
+const RESOLVE_WORKERS = 32
+
+// -resolve: lines that aren't addresses but look like hostnames
+type ResolveStats struct {
+	Names     uint64 `json:"names"` // distinct
+	Resolved  uint64 `json:"resolved"`
+	Failed    uint64 `json:"failed"`
+	Addresses uint64 `json:"addresses"` // A records of all resolved names, duplicates included
+}
+
+// Names are only collected while parsing, so workers never wait for DNS. The lookups run
+// after the parse, see resolve. Every distinct name is looked up once per run, also across files
+type hostResolver struct {
+	mu      sync.Mutex
+	pending map[string]struct{}
+	seen    map[string]struct{} // pending and already resolved
+	stats   ResolveStats
+}
+
+var resolver *hostResolver
+
+func newHostResolver() *hostResolver {
+	return &hostResolver{pending: make(map[string]struct{}), seen: make(map[string]struct{})}
+}
+
+// false if the line (or -col field) isn't a hostname
+func (r *hostResolver) collect(data []byte, start, end int) bool {
+	if config.Column > 0 {
+		var ok bool
+		if start, end, ok = getField(data, start, end, config.Column, config.FieldSep); !ok {
+			return false
+		}
+	}
+	for start < end && isSpace(data[start]) {
+		start++
+	}
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+	if !isHostname(data[start:end]) {
+		return false
+	}
+
+	r.mu.Lock()
+	if _, ok := r.seen[string(data[start:end])]; !ok {
+		name := string(data[start:end])
+		r.seen[name] = struct{}{}
+		r.pending[name] = struct{}{}
+	}
+	r.mu.Unlock()
+	return true
+}
+
+// Letters, digits, '-' and '.', at most 253 bytes and at least one letter,
+// so a broken address like 1.2.3 isn't sent to DNS
+func isHostname(name []byte) bool {
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	letters := false
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			letters = true
+		case c >= '0' && c <= '9', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return letters
+}
+
+// Looks up every pending name with RESOLVE_WORKERS workers, each one with its own timeout.
+// All A records of a name are counted, -prefix and -allow/-block apply to them as to any address
+func (r *hostResolver) resolve(counter Counter, timeout time.Duration) {
+	names := make(chan string, len(r.pending))
+	for name := range r.pending {
+		names <- name
+	}
+	close(names)
+	r.stats.Names += uint64(len(r.pending))
+
+	var wg sync.WaitGroup
+	for range min(RESOLVE_WORKERS, len(r.pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker, done := workerCounter(counter)
+			defer done()
+
+			for name := range names {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", name)
+				cancel()
+
+				for _, ip := range ips {
+					if ip4 := ip.To4(); ip4 != nil {
+						address := uint32(ip4[0])<<24 | uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3])
+						if config.Prefix < 0 || address>>24 == uint32(config.Prefix) {
+							worker.Add(address)
+						}
+					}
+				}
+
+				r.mu.Lock()
+				if err != nil || len(ips) == 0 {
+					r.stats.Failed++
+				} else {
+					r.stats.Resolved++
+					r.stats.Addresses += uint64(len(ips))
+				}
+				r.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	clear(r.pending)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// IPV4_UNIQUE_WORKERS=4 is -workers 4
+const ENV_PREFIX = "IPV4_UNIQUE_"
+
+// Defaults < -config file < environment < command line. Both sources go through flag.Set,
+// so their values are validated exactly like flags. Anything set on the command line is left alone
+func loadSettings() error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if config.ConfigFile == "" {
+		config.ConfigFile = os.Getenv(envName("config"))
+	}
+	if config.ConfigFile != "" {
+		if err := loadConfigFile(config.ConfigFile, explicit); err != nil {
+			return fmt.Errorf("-config %s: %w", config.ConfigFile, err)
+		}
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || f.Name == "config" || err != nil {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+func envName(flagName string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// JSON object keyed by flag name: {"workers": 4, "block": "bad.txt", "json": true}.
+// Unknown keys are an error, a typo shouldn't silently do nothing
+func loadConfigFile(filename string, explicit map[string]bool) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&settings); err != nil {
+		return err
+	}
+
+	for name, raw := range settings {
+		if flag.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		value, err := settingValue(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Strings, numbers and booleans, as they would be written on the command line
+func settingValue(raw json.RawMessage) (string, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("must be a string, number or boolean")
+}
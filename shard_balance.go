@@ -0,0 +1,60 @@
+package main
+
+import "math"
+
+// How evenly a sharded map spreads its elements. Skewed shards mean lock contention
+// and uneven memory, so this is what to look at when tuning the hash or the shard count
+type ShardBalance struct {
+	Map    string   `json:"map"`
+	Shards []uint64 `json:"shards"`
+	Min    uint64   `json:"min"`
+	Max    uint64   `json:"max"`
+	Mean   float64  `json:"mean"`
+	StdDev float64  `json:"stddev"`
+}
+
+// Sets of the last -pairs / -count-unique-ports run, kept for -debug
+var pairSet, endpointSet *ShardedSet[uint64]
+
+func getShardBalance(name string, sizes [SHARDS_AMOUNT]uint64) ShardBalance {
+	balance := ShardBalance{Map: name, Shards: sizes[:], Min: math.MaxUint64}
+
+	total := uint64(0)
+	for _, size := range sizes {
+		total += size
+		balance.Min = min(balance.Min, size)
+		balance.Max = max(balance.Max, size)
+	}
+	balance.Mean = float64(total) / SHARDS_AMOUNT
+
+	variance := 0.0
+	for _, size := range sizes {
+		diff := float64(size) - balance.Mean
+		variance += diff * diff
+	}
+	balance.StdDev = math.Sqrt(variance / SHARDS_AMOUNT)
+	return balance
+}
+
+// Every map-backed mode of this run. Diagnostic only, the maps aren't modified
+func getShardBalances(counter Counter) []ShardBalance {
+	var balances []ShardBalance
+	if sparse, ok := counter.(*SparseSet); ok {
+		balances = append(balances, getShardBalance("sparse", sparse.set.shardSizes()))
+	}
+	if pairSet != nil {
+		balances = append(balances, getShardBalance("pairs", pairSet.shardSizes()))
+	}
+	if endpointSet != nil {
+		balances = append(balances, getShardBalance("endpoints", endpointSet.shardSizes()))
+	}
+	if ipv6 != nil {
+		balances = append(balances,
+			getShardBalance("ipv6 hosts", ipv6.hosts.shardSizes()),
+			getShardBalance("ipv6 /64 networks", ipv6.networks.shardSizes()))
+	}
+	if frequencies != nil {
+		balances = append(balances, getShardBalance("frequencies", frequencies.shardSizes()))
+	}
+	return balances
+}
@@ -0,0 +1,58 @@
+package main
+
+import "sync"
+
+const SHARDS_AMOUNT = 256
+
+// Concurrent set for everything that doesn't fit into the 32 bit bitmap (pairs, IPv6).
+// Sharded the same 256-way as the bitmap, every shard has its own lock
+type ShardedSet[K comparable] struct {
+	shards [SHARDS_AMOUNT]setShard[K]
+	index  func(key K) int
+}
+
+type setShard[K comparable] struct {
+	mu    sync.Mutex
+	items map[K]struct{}
+}
+
+func NewShardedSet[K comparable](index func(key K) int) *ShardedSet[K] {
+	set := &ShardedSet[K]{index: index}
+	for i := range set.shards {
+		set.shards[i].items = make(map[K]struct{})
+	}
+	return set
+}
+
+// Keys like src<<32|dst have a skewed high byte, so the shard byte is taken from a mixed key
+func shardIndex(key uint64) int {
+	return int((key * 0x9E3779B97F4A7C15) >> 56)
+}
+
+func (s *ShardedSet[K]) Add(key K) {
+	shard := &s.shards[s.index(key)]
+	shard.mu.Lock()
+	shard.items[key] = struct{}{}
+	shard.mu.Unlock()
+}
+
+func (s *ShardedSet[K]) Count() uint64 {
+	total := uint64(0)
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		total += uint64(len(s.shards[i].items))
+		s.shards[i].mu.Unlock()
+	}
+	return total
+}
+
+// Elements per shard, for -debug balance reporting
+func (s *ShardedSet[K]) shardSizes() [SHARDS_AMOUNT]uint64 {
+	var sizes [SHARDS_AMOUNT]uint64
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		sizes[i] = uint64(len(s.shards[i].items))
+		s.shards[i].mu.Unlock()
+	}
+	return sizes
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// -single is the reference: the parallel path has to set exactly the same bits
+func TestSingleMatchesParallel(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	var addresses strings.Builder
+	for range 20000 {
+		// Few /16s, so there are plenty of duplicates and shared words
+		fmt.Fprintf(&addresses, "%d.%d.%d.%d\n", random.IntN(3), random.IntN(2), random.IntN(256), random.IntN(256))
+	}
+
+	inputs := map[string]string{
+		"random":          addresses.String(),
+		"no last newline": "1.2.3.4\n5.6.7.8\n9.10.11.12",
+		"crlf":            "1.2.3.4\r\n255.255.255.255\r\n0.0.0.0\r\n",
+		"long line":       "1.2.3.4\n" + strings.Repeat("9", 100) + "\n5.6.7.8\n",
+		"one line":        "10.20.30.40",
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			filename := writeInput(t, "in.txt", input)
+			count := func(single bool, workers int) (uint64, *Bitmap) {
+				resetConfig(t)
+				config.Single = single
+				config.MaxLineLength = 64
+				WORKERS_AMOUNT = workers
+				b := newTestBitmap(t)
+				return countUniqueIPs([]string{filename}, b), b
+			}
+
+			want, reference := count(true, 1)
+			for _, workers := range []int{1, 4, 16} {
+				got, b := count(false, workers)
+				if got != want || b.segments != reference.segments {
+					t.Errorf("%d workers: got %d, -single %d, same bits %v", workers, got, want, b.segments == reference.segments)
+				}
+			}
+		})
+	}
+}
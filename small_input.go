@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Below this much input the count is tallied while adding instead of the popcount over 512 MB:
+// for a few thousand lines the scan costs ~100x more than the parsing, however many workers share it.
+// Processing itself already runs in one worker below MIN_BYTES_PER_WORKER.
+// BenchmarkSmallInputCrossover: the tally costs ~0.7 ms per MB over the plain path, the popcount
+// is a fixed 20-130 ms by core count, so they cross at a few tens of MB on a big box. 1 MB stays
+// well below that everywhere, inputs that size are already dominated by the scan
+const DEFAULT_PARALLEL_COUNT_THRESHOLD = 1 << 20
+
+// Set in main for small inputs on the dense backend, nil otherwise
+var smallInputTally *atomic.Uint64
+
+// Innermost wrapper: counts 0 -> 1 transitions, their sum is exactly the bitmap's popcount
+type tallyCounter struct {
+	bitmap *Bitmap
+	tally  *atomic.Uint64
+}
+
+func (c *tallyCounter) Add(ip uint32) {
+	if c.bitmap.AddNew(ip) {
+		c.tally.Add(1)
+	}
+}
+
+func (c *tallyCounter) Count() uint64 {
+	return c.tally.Load()
+}
+
+// Prefix counts one segment and -single has its own loop, both skip the tally.
+// With staging (-file-timeout, -per-file-dups) bits are new to a staging bitmap, not to the result.
+// Progress and the commit log take the tally's place as the innermost wrapper, with them nothing would tally
+func usesSmallInputTally(filenames []string) bool {
+	return bitmap != nil && config.Prefix < 0 && !config.Single && config.MeasureRuns == 0 && !config.stagesFiles() &&
+		!config.Progress && config.CommitLog == "" && isSmallInput(filenames, config.ParallelCountThreshold)
+}
+
+// Only regular files count as small: stdin, -fd and URLs have no size up front
+func isSmallInput(filenames []string, threshold int64) bool {
+	total := int64(0)
+	for _, filename := range filenames {
+		if isURL(filename) || isFDInput(filename) {
+			return false
+		}
+		fileInfo, err := os.Stat(filename)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			return false
+		}
+		total += fileInfo.Size()
+	}
+	return total < threshold
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Whatever wraps the bitmap innermost, a small input has to count the same as a full popcount
+func TestSmallInputCount(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func()
+		tally bool
+	}{
+		{"plain", func() {}, true},
+		{"progress", func() {
+			config.Progress = true
+			progress = &Progress{}
+		}, false},
+		{"commit log", func() { config.CommitLog = "ips.log" }, false},
+		{"prefix", func() { config.Prefix = 10 }, false},
+		{"threshold 0", func() { config.ParallelCountThreshold = 0 }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t)
+			test.setup()
+			filename := writeInput(t, "s.txt", "10.0.0.1\n10.0.0.2\n10.0.0.1\n10.0.0.3\n")
+			counter := Counter(newTestBitmap(t))
+			bitmap = counter.(*Bitmap)
+
+			files := []string{filename}
+			if got := usesSmallInputTally(files); got != test.tally {
+				t.Fatalf("usesSmallInputTally = %v, want %v", got, test.tally)
+			}
+			if test.tally {
+				smallInputTally = &atomic.Uint64{}
+			}
+			if count := countUniqueIPs(files, counter); count != 3 {
+				t.Errorf("count = %d, want 3", count)
+			}
+		})
+	}
+}
+
+// Tallying while adding against the popcount after it, over input sizes: the tally costs
+// per new address, the popcount a fixed scan of 512 MB. Where they cross decides
+// DEFAULT_PARALLEL_COUNT_THRESHOLD: go test -bench SmallInputCrossover
+func BenchmarkSmallInputCrossover(b *testing.B) {
+	r := rand.New(rand.NewPCG(17, 18))
+	bm := newTestBitmap(b)
+
+	for _, size := range []int{64 << 10, 1 << 20, 16 << 20, 64 << 20} {
+		var input strings.Builder
+		for input.Len() < size {
+			ip := r.Uint32()
+			fmt.Fprintf(&input, "%d.%d.%d.%d\n", ip>>24, ip>>16&0xFF, ip>>8&0xFF, ip&0xFF)
+		}
+		filename := writeInput(b, "in.txt", input.String())
+
+		for _, tally := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%dKB/tally=%v", size>>10, tally), func(b *testing.B) {
+				resetConfig(b)
+				bitmap = bm
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					b.StopTimer()
+					bm.Reset() // every address new again, as in a real run
+					smallInputTally = nil
+					if tally {
+						smallInputTally = &atomic.Uint64{}
+					}
+					b.StartTimer()
+					countUniqueIPs([]string{filename}, bm)
+				}
+			})
+		}
+	}
+}
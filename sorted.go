@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// Summary of one chunk of sorted input: changes between neighbour addresses plus
+// the edges, so chunks can be stitched together without any bitmap
+type sortedChunk struct {
+	unique      uint64 // addresses that differ from the previous one, the first one included
+	first, last uint32
+	firstLine   []byte // edges as text, for the byte order check across chunks
+	lastLine    []byte
+	numeric     bool // non-decreasing by value so far
+	text        bool // non-decreasing as bytes (LC_ALL=C sort) so far
+	empty       bool
+}
+
+// With sorted input duplicates are neighbours, so comparing every address with the previous one
+// is a full unique count in O(1) memory. Input sorted by value (-list, sort -n by octets) and
+// by text (plain sort) both keep duplicates together. Malformed lines are skipped
+func processChunkSorted(data []byte, start, end int) sortedChunk {
+	chunk := sortedChunk{numeric: true, text: true, empty: true}
+	var prevLine []byte
+
+	lineStart := start
+	for i := start; i <= end; i++ {
+		if i < end && data[i] != '\n' {
+			continue
+		}
+		line := data[lineStart:i]
+		lineStart = i + 1
+
+		ip, ok := parseIPv4Strict(line, 0, len(line))
+		if !ok {
+			continue
+		}
+
+		if chunk.empty {
+			chunk.empty = false
+			chunk.first, chunk.firstLine = ip, line
+			chunk.unique = 1
+		} else {
+			if ip != chunk.last {
+				chunk.unique++
+			}
+			chunk.numeric = chunk.numeric && ip >= chunk.last
+			chunk.text = chunk.text && bytes.Compare(line, prevLine) >= 0
+		}
+		chunk.last, prevLine = ip, line
+	}
+	chunk.lastLine = prevLine
+	return chunk
+}
+
+// Sums up chunk counts in file order, an address continuing over a chunk boundary is counted once.
+// With verify, input that is sorted neither by value nor by text is an error
+func reconcileSortedChunks(chunks []sortedChunk, verify bool) (uint64, error) {
+	total := uint64(0)
+	numeric, text := true, true
+	var prev *sortedChunk
+
+	for i := range chunks {
+		chunk := &chunks[i]
+		if chunk.empty {
+			continue
+		}
+
+		total += chunk.unique
+		numeric = numeric && chunk.numeric
+		text = text && chunk.text
+		if prev != nil {
+			if prev.last == chunk.first {
+				total--
+			}
+			numeric = numeric && chunk.first >= prev.last
+			text = text && bytes.Compare(chunk.firstLine, prev.lastLine) >= 0
+		}
+		prev = chunk
+	}
+
+	if verify && !numeric && !text {
+		return 0, fmt.Errorf("input is not sorted (neither by address value nor as text), -sorted would miscount it")
+	}
+	return total, nil
+}
+
+func countUniqueSorted(filename string, verify bool) (uint64, error) {
+	var mu sync.Mutex
+	var chunks []sortedChunk
+
+	processFile(filename, func(data []byte, t task) {
+		chunk := processChunkSorted(data, t.start, t.end)
+		// Mmapped data is gone once the file is done, keep own copies of the edges
+		chunk.firstLine = bytes.Clone(chunk.firstLine)
+		chunk.lastLine = bytes.Clone(chunk.lastLine)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for len(chunks) <= t.index {
+			chunks = append(chunks, sortedChunk{empty: true})
+		}
+		chunks[t.index] = chunk
+	})
+
+	return reconcileSortedChunks(chunks, verify)
+}
@@ -0,0 +1,19 @@
+package main
+
+// Exact backend for sparse data: memory grows with the number of unique addresses
+// (~40 bytes each) instead of the fixed 512 MB, so it wins below ~10M uniques
+type SparseSet struct {
+	set *ShardedSet[uint64]
+}
+
+func NewSparseSet() *SparseSet {
+	return &SparseSet{set: NewShardedSet(shardIndex)}
+}
+
+func (s *SparseSet) Add(ip uint32) {
+	s.set.Add(uint64(ip))
+}
+
+func (s *SparseSet) Count() uint64 {
+	return s.set.Count()
+}
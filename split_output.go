@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Writes unique addresses into dir/<first octet>.txt, one file per bitmap segment.
+// Text is rendered per /16 block in parallel, files are written one after another
+func writeSplitOutput(bitmap *Bitmap, dir string, writeEmpty bool) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		panic(err.Error())
+	}
+
+	var file *os.File
+	var writer *bufio.Writer
+
+	renderBlocksOrdered(bitmap, func(buf []byte, ip uint32) []byte {
+		return append(appendIPv4(buf, ip), '\n')
+	}, func(block int, data []byte) {
+		octet := block >> 8
+
+		// File is created lazily on the first address, so empty segments produce no file
+		if writer == nil && (len(data) > 0 || writeEmpty) {
+			file, writer = createSegmentFile(filepath.Join(dir, strconv.Itoa(octet)+".txt"))
+		}
+		if len(data) > 0 {
+			writer.Write(data)
+		}
+
+		if block&0xFF == 0xFF && writer != nil {
+			closeSegmentFile(file, writer)
+			file, writer = nil, nil
+		}
+	})
+}
+
+func createSegmentFile(path string) (*os.File, *bufio.Writer) {
+	file, err := os.Create(path)
+	if err != nil {
+		panic(err.Error())
+	}
+	return file, bufio.NewWriterSize(file, 1<<20)
+}
+
+func closeSegmentFile(file *os.File, writer *bufio.Writer) {
+	if err := writer.Flush(); err != nil {
+		panic(err.Error())
+	}
+	if err := file.Close(); err != nil {
+		panic(err.Error())
+	}
+}
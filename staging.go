@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -file-timeout and -per-file-dups: every file is counted into a staging bitmap of its own and
+// merged into the result only once it's done.
+// With -file-timeout a file that runs out of time leaves nothing behind. A file stuck in a read
+// (hung network mount) can't be interrupted, its worker is abandoned together with its staging
+// bitmap and the run goes on with the next file.
+// With -per-file-dups the staging bitmap is the file's own distinct set
+type stagedFiles struct {
+	mu         sync.Mutex // merges into the shared bitmap aren't atomic
+	staging    chan *Bitmap
+	abandoned  atomic.Int64 // timed out files whose workers are still running
+	timedOut   []string
+	duplicates []FileDuplicates
+}
+
+// Abandoned workers still hanging at once, each holds its 512 MB staging bitmap until it returns.
+// One more fails the run instead of allocating without bound
+const MAX_ABANDONED_FILES = 8
+
+// Workers of timed out files that haven't returned yet. The run doesn't wait for them,
+// tests do before they change the config under them
+var abandonedWorkers sync.WaitGroup
+
+// Per file processing of processFilesInto: process gets the file's chunks, done is called once all
+// of them are in and the file counts. Without staging there's one for all files
+type fileChunks func(counter Counter) (process func(data []byte, chunk task), done func())
+
+// Lines of a file against its own distinct addresses, before the union with other files
+type FileDuplicates struct {
+	File          string  `json:"file"`
+	Lines         uint64  `json:"lines"`
+	Distinct      uint64  `json:"distinct"`
+	DuplicateRate float64 `json:"duplicate_rate"`
+	index         int
+}
+
+// Names of the files that ran out of -file-timeout, in the order they timed out
+var timedOutFiles []string
+
+// -per-file-dups in input order
+var fileDuplicates []FileDuplicates
+
+// Like processFiles, but with staging chunks of each file go to their own counter
+func processFilesInto(filenames []string, counter Counter, chunks fileChunks) {
+	if !config.stagesFiles() {
+		process, done := chunks(counter)
+		processFiles(filenames, process)
+		done()
+		return
+	}
+
+	// Room for every bitmap that can exist, abandoned ones come back when their workers return
+	inFlight := min(config.ParallelFiles, len(filenames))
+	timeouts := &stagedFiles{staging: make(chan *Bitmap, inFlight+MAX_ABANDONED_FILES)}
+
+	files := make(chan task, len(filenames))
+	for i := range filenames {
+		files <- task{index: i}
+	}
+	close(files)
+
+	runWorkers(inFlight, files, func(t task) {
+		if deadlineExpired.Load() || errexit.stoppedFile(t.index) {
+			return
+		}
+		timeouts.process(t.index, filenames[t.index], bitmap, chunks)
+	})
+	timedOutFiles = append(timedOutFiles, timeouts.timedOut...)
+
+	slices.SortFunc(timeouts.duplicates, func(a, b FileDuplicates) int {
+		return cmp.Compare(a.index, b.index)
+	})
+	fileDuplicates = append(fileDuplicates, timeouts.duplicates...)
+}
+
+func (f *stagedFiles) process(index int, filename string, dst *Bitmap, chunks fileChunks) {
+	staging := f.get()
+	process, done := chunks(staging)
+
+	var expired atomic.Bool
+	var lines atomic.Uint64
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		processFile(filename, func(data []byte, chunk task) {
+			forEachPiece(data, chunk, DEADLINE_PIECE_BYTES, func(piece task) bool {
+				if expired.Load() {
+					return false
+				}
+				piece.file = index
+				process(data, piece)
+				if config.PerFileDups {
+					lines.Add(countLines(data[piece.start:piece.end]))
+				}
+				return true
+			})
+		})
+	}()
+
+	// nil channel without -file-timeout, never ready
+	var timeout <-chan time.Time
+	if config.FileTimeout > 0 {
+		timer := time.NewTimer(config.FileTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-finished:
+		if config.PerFileDups {
+			duplicates := FileDuplicates{File: filename, Lines: lines.Load(), Distinct: staging.Count(), index: index}
+			if duplicates.Lines > 0 {
+				duplicates.DuplicateRate = float64(duplicates.Lines-min(duplicates.Distinct, duplicates.Lines)) / float64(duplicates.Lines)
+			}
+			f.mu.Lock()
+			f.duplicates = append(f.duplicates, duplicates)
+			f.mu.Unlock()
+		}
+
+		// Progress counts uniques here, a file's own new addresses may be in the total already
+		f.mu.Lock()
+		if progress != nil {
+			progress.uniques.Add(mergeNewBits(dst, staging))
+		} else {
+			MergeBitmaps(dst, staging)
+		}
+		f.mu.Unlock()
+		done()
+		staging.Reset()
+		f.staging <- staging
+		filesProcessed.Add(1)
+	case <-timeout:
+		// The worker may still be writing into staging, it's reused only once the worker returns
+		expired.Store(true)
+		f.mu.Lock()
+		f.timedOut = append(f.timedOut, filename)
+		f.mu.Unlock()
+
+		if f.abandoned.Add(1) > MAX_ABANDONED_FILES {
+			fatal(fmt.Errorf("-file-timeout: over %d timed out files are still hanging, giving up", MAX_ABANDONED_FILES))
+		}
+		abandonedWorkers.Add(1)
+		go func() {
+			defer abandonedWorkers.Done()
+			<-finished
+			staging.Reset()
+			f.abandoned.Add(-1)
+			f.staging <- staging
+		}()
+	}
+}
+
+// Staging bitmaps are reused between files, a new one only replaces one held by an abandoned worker
+func (f *stagedFiles) get() *Bitmap {
+	select {
+	case staging := <-f.staging:
+		return staging
+	default:
+	}
+	staging, err := allocateBitmap()
+	if err != nil {
+		fatal(err)
+	}
+	return staging
+}
+
+// A last line without '\n' is a line too
+func countLines(data []byte) uint64 {
+	lines := uint64(bytes.Count(data, []byte{'\n'}))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
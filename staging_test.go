@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A FIFO without a writer blocks in open, like a read from a hung network mount
+func hungInput(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hung")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skip("no FIFOs:", err)
+	}
+
+	t.Cleanup(func() {
+		// Lets the abandoned worker return, and waits for it before the config is reset under it
+		if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			file.Close()
+		}
+		abandonedWorkers.Wait()
+	})
+	return path
+}
+
+// The count and the line stats both cover only the files that finished in time
+func TestFileTimeoutSkipsHungFile(t *testing.T) {
+	resetConfig(t)
+	config.FileTimeout = 100 * time.Millisecond
+	config.Stats = true
+	bitmap = newTestBitmap(t)
+
+	good := writeInput(t, "good.txt", "1.1.1.1\n2.2.2.2\nbad\n1.1.1.1\n")
+	hung := hungInput(t)
+
+	count, stats, err := countUniqueIPsChecked([]string{good, hung}, bitmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+	if stats.Lines != 4 || stats.Malformed != 1 {
+		t.Errorf("lines %d, malformed %d, want 4 and 1", stats.Lines, stats.Malformed)
+	}
+	if !slices.Equal(timedOutFiles, []string{hung}) {
+		t.Errorf("timed out %v, want [%s]", timedOutFiles, hung)
+	}
+}
+
+func TestPerFileDuplicates(t *testing.T) {
+	resetConfig(t)
+	config.PerFileDups = true
+	bitmap = newTestBitmap(t)
+
+	a := writeInput(t, "a.txt", "1.1.1.1\n1.1.1.1\n2.2.2.2\n1.1.1.1")
+	b := writeInput(t, "b.txt", "2.2.2.2\n3.3.3.3\n")
+
+	if count := countUniqueIPs([]string{a, b}, bitmap); count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+
+	want := []FileDuplicates{
+		{File: a, Lines: 4, Distinct: 2, DuplicateRate: 0.5},
+		{File: b, Lines: 2, Distinct: 2, DuplicateRate: 0, index: 1},
+	}
+	if !slices.Equal(fileDuplicates, want) {
+		t.Errorf("got %+v, want %+v", fileDuplicates, want)
+	}
+}
+
+// Progress uniques are the shared count, not the distinct addresses of the file being read
+func TestStagedProgressUniques(t *testing.T) {
+	resetConfig(t)
+	config.PerFileDups = true
+	bitmap = newTestBitmap(t)
+	progress = &Progress{}
+	t.Cleanup(func() { progress = nil })
+
+	a := writeInput(t, "a.txt", "1.1.1.1\n2.2.2.2\n1.1.1.1\n")
+	b := writeInput(t, "b.txt", "2.2.2.2\n3.3.3.3\n")
+
+	if count := countUniqueIPs([]string{a, b}, bitmap); count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+	if uniques, lines := progress.uniques.Load(), progress.lines.Load(); uniques != 3 || lines != 5 {
+		t.Errorf("progress uniques %d, lines %d, want 3 and 5", uniques, lines)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// "-" on the command line is stdin
+const STDIN_INPUT = "-"
+
+var GZIP_MAGIC = []byte{0x1f, 0x8b}
+
+func readsStdin() bool {
+	return stdinInputs() > 0
+}
+
+func stdinInputs() int {
+	n := 0
+	for _, filename := range flag.Args() {
+		if filename == STDIN_INPUT {
+			n++
+		}
+	}
+	if config.FD == 0 {
+		n++
+	}
+	return n
+}
+
+func processStdin(process func(data []byte, chunk task)) {
+	if err := processOpenFile(os.Stdin, "stdin", process); err != nil {
+		fatal(fmt.Errorf("stdin: %w", err))
+	}
+}
+
+// Stdin and -fd: a regular file is mmapped as usual, pipes and sockets can't be, they are
+// streamed through the reader path. Gzip is detected by its magic and decompressed inline
+func processOpenFile(file *os.File, filename string, process func(data []byte, chunk task)) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// ReadAt doesn't move the offset, a plain file stays in one piece for the mmap
+	if fileInfo.Mode().IsRegular() && !needsDecoding(config.InputEncoding) {
+		magic := make([]byte, len(GZIP_MAGIC))
+		n, _ := file.ReadAt(magic, 0)
+		if !bytes.Equal(magic[:n], GZIP_MAGIC) {
+			data, closeFile := getMmapDataFromFile(file)
+			defer closeFile()
+
+			processMapped(filename, data, process)
+			return nil
+		}
+	}
+
+	defer file.Close()
+	r, err := gunzipIfCompressed(file)
+	if err != nil {
+		return err
+	}
+	return processReader(wrapDecoder(r, config.InputEncoding), process)
+}
+
+// Peeks the first two bytes without consuming them. Gzip gets decompressed, concatenated
+// members included like zcat does, anything else is passed through untouched. Empty input is
+// just empty: Peek can't get two bytes and it's passed through to end right away
+func gunzipIfCompressed(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(GZIP_MAGIC))
+	if !bytes.Equal(magic, GZIP_MAGIC) {
+		return buffered, nil
+	}
+	return gzip.NewReader(buffered)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+const STDOUT_BUFFER_SIZE = 4 << 20
+
+// Where results go: plain os.Stdout, or one big buffer in front of it with -stdout-buffered
+var stdout io.Writer = os.Stdout
+
+var stdoutBuffer *bufferedStdout
+
+// Locked, so a signal can flush while main is still writing
+type bufferedStdout struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (b *bufferedStdout) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.w.Write(p)
+}
+
+func (b *bufferedStdout) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.w.Flush()
+}
+
+// Everything written so far is flushed on exit, fatal errors and SIGINT/SIGTERM,
+// so an interrupted run still leaves the output it has produced
+func setupStdout() {
+	if !config.StdoutBuffered {
+		return
+	}
+	stdoutBuffer = &bufferedStdout{w: bufio.NewWriterSize(os.Stdout, STDOUT_BUFFER_SIZE)}
+	stdout = stdoutBuffer
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
+
+func flushStdout() {
+	if stdoutBuffer != nil {
+		stdoutBuffer.flush()
+	}
+}
+
+// os.Exit skips deferred calls, the buffer has to be flushed first
+func exit(code int) {
+	flushStdout()
+	os.Exit(code)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Distinct addresses seen within the last window of a continuous stream, with 1 second resolution.
+// Every address keeps its last seen second, and a FIFO of (address, second) sightings says what
+// to evict: the oldest sightings leave once they fall out of the window, and an address is dropped
+// only if that sighting is still its last one. A sighting is queued once per address per second,
+// so memory is about distinct addresses in the window + distinct (address, second) pairs in it,
+// roughly 40 bytes each, not one entry per line
+type StreamWindow struct {
+	window   int64 // seconds
+	lastSeen map[uint32]int64
+	queue    []streamSighting // oldest first
+	newest   int64
+}
+
+type streamSighting struct {
+	ip     uint32
+	second int64
+}
+
+func NewStreamWindow(window time.Duration) *StreamWindow {
+	return &StreamWindow{window: int64(window / time.Second), lastSeen: make(map[uint32]int64)}
+}
+
+// Timestamps should be roughly in order: a late sighting is queued behind newer ones
+// and leaves the window with them. Sightings already older than the window are ignored
+func (w *StreamWindow) Add(ip uint32, second int64) {
+	if second <= w.newest-w.window {
+		return
+	}
+	w.newest = max(w.newest, second)
+
+	if last, ok := w.lastSeen[ip]; ok && last >= second {
+		return
+	}
+	w.lastSeen[ip] = second
+	w.queue = append(w.queue, streamSighting{ip: ip, second: second})
+}
+
+// Drops everything last seen at or before now - window
+func (w *StreamWindow) Evict(now int64) {
+	cutoff := now - w.window
+	evicted := 0
+	for _, sighting := range w.queue {
+		if sighting.second > cutoff {
+			break
+		}
+		if w.lastSeen[sighting.ip] == sighting.second {
+			delete(w.lastSeen, sighting.ip)
+		}
+		evicted++
+	}
+	// Plain reslicing, append reallocates and drops the evicted head sooner or later
+	w.queue = w.queue[evicted:]
+}
+
+func (w *StreamWindow) Count() uint64 {
+	return uint64(len(w.lastSeen))
+}
+
+// Counts r until EOF, printing the window count to out every interval and once more at the end.
+// Without -ts-col lines are stamped with the wall clock on arrival, with it the window
+// follows the newest timestamp of the stream
+func runStreamWindow(r io.Reader, out io.Writer, window, interval time.Duration) uint64 {
+	stream := NewStreamWindow(window)
+	var mu sync.Mutex
+
+	report := func() {
+		now := time.Now().Unix()
+		if config.TimestampColumn > 0 {
+			now = stream.newest
+		}
+		stream.Evict(now)
+		fmt.Fprintf(out, "%s: %s unique over last %v\n", time.Unix(now, 0).UTC().Format(time.RFC3339), formatCount(stream.Count()), window)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				report()
+				mu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		ip, ok := parseLineIPv4(line, 0, len(line))
+		if !ok {
+			continue
+		}
+
+		second := time.Now().Unix()
+		if config.TimestampColumn > 0 {
+			if second, ok = parseLineTimestamp(line); !ok {
+				continue
+			}
+		}
+
+		mu.Lock()
+		stream.Add(ip, second)
+		mu.Unlock()
+	}
+	close(done)
+	if err := scanner.Err(); err != nil {
+		fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	report()
+	return stream.Count()
+}
+
+// -ts-col field as unix seconds (fraction allowed) or RFC 3339
+func parseLineTimestamp(line []byte) (int64, bool) {
+	start, end, ok := getField(line, 0, len(line), config.TimestampColumn, config.FieldSep)
+	if !ok {
+		return 0, false
+	}
+	field := string(line[start:end])
+
+	if seconds, err := strconv.ParseFloat(field, 64); err == nil {
+		return int64(seconds), true
+	}
+	if t, err := time.Parse(time.RFC3339, field); err == nil {
+		return t.Unix(), true
+	}
+	return 0, false
+}
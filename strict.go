@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const EXIT_MALFORMED_LINE = 5
+
+// How often workers look whether an earlier chunk already failed
+const CANCEL_CHECK_LINES = 4096
+
+// First malformed line of the input for -strict-errexit: the earliest line of the first file that has one
+type MalformedLineError struct {
+	File    string
+	Line    uint64 // global within the file, 1-based
+	Content string
+	file    int
+	chunk   int
+}
+
+func (e *MalformedLineError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("malformed line %d: %q", e.Line, e.Content)
+	}
+	return fmt.Sprintf("%s: malformed line %d: %q", e.File, e.Line, e.Content)
+}
+
+// Shared cancellation between workers of all files. A failure in chunk k of file f stops only what
+// comes after it: chunks after k and later files. Earlier chunks and files keep going because
+// they may hold an even earlier malformed line
+type cancellation struct {
+	failedAt atomic.Int64 // position of the failed chunk
+	mu       sync.Mutex
+	err      *MalformedLineError
+}
+
+// Set while -strict-errexit counts, processFiles doesn't start files past a failure
+var errexit *cancellation
+
+func newCancellation() *cancellation {
+	c := &cancellation{}
+	c.failedAt.Store(math.MaxInt64)
+	return c
+}
+
+// Files in input order, chunks in file order
+func chunkPosition(file, chunk int) int64 {
+	return int64(file)<<32 | int64(chunk)
+}
+
+func (c *cancellation) fail(err *MalformedLineError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	position := chunkPosition(err.file, err.chunk)
+	if c.err == nil || position < chunkPosition(c.err.file, c.err.chunk) {
+		c.err = err
+		c.failedAt.Store(position)
+	}
+}
+
+func (c *cancellation) stopped(file, chunk int) bool {
+	return c.failedAt.Load() < chunkPosition(file, chunk)
+}
+
+// A failure in an earlier file, nil means nothing to stop
+func (c *cancellation) stoppedFile(file int) bool {
+	return c != nil && c.failedAt.Load() < chunkPosition(file, 0)
+}
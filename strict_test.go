@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The first file with a malformed line wins, even if a later file has one at a smaller line number
+func TestStrictErrexitFirstFile(t *testing.T) {
+	resetConfig(t)
+	config.StrictErrexit = true
+	WORKERS_AMOUNT = 4
+
+	var a strings.Builder
+	for range 300 {
+		a.WriteString("10.0.0.1\n")
+	}
+	a.WriteString("BAD_A\n")
+	first := writeInput(t, "a.txt", a.String())
+	second := writeInput(t, "b.txt", "1.1.1.1\n2.2.2.2\n3.3.3.3\nBAD_B\n")
+	clean := writeInput(t, "c.txt", "4.4.4.4\n")
+
+	for _, files := range [][]string{{first, second}, {clean, first, second}} {
+		_, _, err := countUniqueIPsChecked(files, newTestBitmap(t))
+
+		var malformed *MalformedLineError
+		if !errors.As(err, &malformed) {
+			t.Fatalf("%v: got %v, want a MalformedLineError", files, err)
+		}
+		if malformed.File != first || malformed.Line != 301 || malformed.Content != "BAD_A" {
+			t.Errorf("%v: got %s", files, err)
+		}
+	}
+}
+
+func TestCancellationOrder(t *testing.T) {
+	c := newCancellation()
+	c.fail(&MalformedLineError{Line: 4, file: 1, chunk: 0})
+	c.fail(&MalformedLineError{Line: 900, file: 0, chunk: 3})
+	c.fail(&MalformedLineError{Line: 1, file: 0, chunk: 5})
+
+	if c.err.Line != 900 {
+		t.Errorf("kept line %d of file %d, want line 900 of file 0", c.err.Line, c.err.file)
+	}
+	if c.stopped(0, 3) || !c.stopped(0, 4) || !c.stopped(1, 0) {
+		t.Error("chunks after the failure must stop, the failed chunk itself not")
+	}
+	if c.stoppedFile(0) || !c.stoppedFile(1) {
+		t.Error("files after the failed one must stop")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Regular file entries of all archives counted so far
+var archiveEntries atomic.Uint64
+
+func isTarArchive(filename string) bool {
+	lower := strings.ToLower(filename)
+	return strings.HasSuffix(lower, ".tar") || isGzipTar(lower)
+}
+
+func isGzipTar(filename string) bool {
+	return strings.HasSuffix(filename, ".tar.gz") || strings.HasSuffix(filename, ".tgz")
+}
+
+// Every regular file of the archive is an input of its own, all of them go into the same counter.
+// Entries are streamed through the reader path, directories, links etc. are skipped
+func processTar(r io.Reader, name string, process func(data []byte, chunk task)) error {
+	if isGzipTar(strings.ToLower(name)) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := processReader(wrapDecoder(archive, config.InputEncoding), process); err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+		archiveEntries.Add(1)
+	}
+}
+
+func processTarFile(filename string, process func(data []byte, chunk task)) {
+	file, err := os.Open(filename)
+	if err != nil {
+		fatal(err)
+	}
+	defer file.Close()
+
+	if err := processTar(file, filename, process); err != nil {
+		fatal(fmt.Errorf("%s: %w", filename, err))
+	}
+}
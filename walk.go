@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/bits"
+	"strconv"
+)
+
+// Calls fn for every address present in one /8 segment, in ascending order
+func walkSegment(bitmap *Bitmap, octet int, fn func(ip uint32)) {
+	base := uint32(octet) << 24
+
+	for wordIdx, word := range &bitmap.segments[octet] {
+		for word != 0 {
+			bitIdx := bits.TrailingZeros64(word)
+			fn(base | uint32(wordIdx)<<6 | uint32(bitIdx))
+			word &= word - 1
+		}
+	}
+}
+
+// /16 blocks (first two octets) - finer work split for output generation than /8 segments
+const BLOCKS_AMOUNT = OCTET_MAX_VALUE * OCTET_MAX_VALUE
+const BLOCK_WORDS = BITMAP_SEGMENT_SIZE / OCTET_MAX_VALUE
+
+// Calls fn for every address present in one /16 block, in ascending order
+func walkBlock(bitmap *Bitmap, block int, fn func(ip uint32)) {
+	octet := block >> 8
+	base := uint32(block) << 16
+	firstWord := (block & 0xFF) * BLOCK_WORDS
+
+	for wordIdx, word := range bitmap.segments[octet][firstWord : firstWord+BLOCK_WORDS] {
+		for word != 0 {
+			bitIdx := bits.TrailingZeros64(word)
+			fn(base | uint32(wordIdx)<<6 | uint32(bitIdx))
+			word &= word - 1
+		}
+	}
+}
+
+// Renders addresses of /16 blocks in parallel and hands them to write one block at a time,
+// in ascending order. Data concentrated in a single /8 is still spread over all workers.
+// Blocks go in batches of a few per worker, so at most a batch of rendered text is in memory
+func renderBlocksOrdered(bitmap *Bitmap, render func(buf []byte, ip uint32) []byte, write func(block int, data []byte)) {
+	batch := WORKERS_SUM_AMOUNT * 8
+	buffers := make([][]byte, batch)
+
+	for first := 0; first < BLOCKS_AMOUNT; first += batch {
+		last := min(first+batch, BLOCKS_AMOUNT)
+		runWorkers(WORKERS_SUM_AMOUNT, blockTasks(first, last), func(t task) {
+			buf := buffers[t.index][:0]
+			walkBlock(bitmap, t.start, func(ip uint32) {
+				buf = render(buf, ip)
+			})
+			buffers[t.index] = buf
+		})
+
+		for block := first; block < last; block++ {
+			write(block, buffers[block-first])
+		}
+	}
+}
+
+// Appends dotted quad form of ip to buf without allocations (if buf has capacity).
+// Always canonical - decimal octets without leading zeros, whatever the input looked like
+func appendIPv4(buf []byte, ip uint32) []byte {
+	buf = strconv.AppendUint(buf, uint64(ip>>24), 10)
+	buf = append(buf, '.')
+	buf = strconv.AppendUint(buf, uint64(ip>>16&0xFF), 10)
+	buf = append(buf, '.')
+	buf = strconv.AppendUint(buf, uint64(ip>>8&0xFF), 10)
+	buf = append(buf, '.')
+	return strconv.AppendUint(buf, uint64(ip&0xFF), 10)
+}
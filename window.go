@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Distinct addresses over the last size files. OR can't remove a file's contribution,
+// so every file keeps its own bitmap and the union is rebuilt from the rest on eviction.
+// Memory: (size + 2) * 512 MB, an evicted file's bitmap is kept for the next file
+type RollingWindow struct {
+	size  int
+	files []windowFile // oldest first
+	union *Bitmap
+	spare *Bitmap
+}
+
+type windowFile struct {
+	name   string
+	bitmap *Bitmap
+}
+
+func NewRollingWindow(size int) *RollingWindow {
+	return &RollingWindow{size: size, union: windowBitmap()}
+}
+
+// mmapped like the main bitmap, so a window too big for memory fails with an error, not a crash
+func windowBitmap() *Bitmap {
+	bitmap, err := allocateBitmap()
+	if err != nil {
+		fatal(fmt.Errorf("-window: %w", err))
+	}
+	return bitmap
+}
+
+// Processes filename into its own bitmap, evicting the oldest file when the window is full.
+// Chunks go through the same path as a plain count, -allow/-block and -prefix included
+func (w *RollingWindow) AddFile(filename string) {
+	fileBitmap := w.spare
+	w.spare = nil
+	if fileBitmap == nil {
+		fileBitmap = windowBitmap()
+	}
+	processFile(filename, func(data []byte, chunk task) {
+		countChunk(data, chunk, fileBitmap)
+	})
+
+	w.files = append(w.files, windowFile{name: filename, bitmap: fileBitmap})
+	MergeBitmaps(w.union, fileBitmap)
+
+	for len(w.files) > w.size {
+		w.EvictOldest()
+	}
+}
+
+// Returns name of the evicted file, false if the window is empty
+func (w *RollingWindow) EvictOldest() (string, bool) {
+	if len(w.files) == 0 {
+		return "", false
+	}
+
+	evicted := w.files[0]
+	w.files[0] = windowFile{}
+	w.files = w.files[1:]
+
+	// Cleared once for the next file instead of a new mapping for every file
+	evicted.bitmap.Reset()
+	if w.spare == nil {
+		w.spare = evicted.bitmap
+	} else {
+		freeBitmap(evicted.bitmap)
+	}
+
+	w.union.Reset()
+	for _, file := range w.files {
+		MergeBitmaps(w.union, file.bitmap)
+	}
+	return evicted.name, true
+}
+
+func (w *RollingWindow) CurrentUnique() uint64 {
+	return w.union.Count()
+}
+
+// Unmaps all bitmaps of the window, it can't be used afterwards
+func (w *RollingWindow) free() {
+	for _, file := range w.files {
+		freeBitmap(file.bitmap)
+	}
+	if w.spare != nil {
+		freeBitmap(w.spare)
+	}
+	freeBitmap(w.union)
+	*w = RollingWindow{}
+}
+
+// Feeds files in the given order, reporting the window after each one
+func runRollingWindow(w io.Writer, size int, filenames []string) uint64 {
+	window := NewRollingWindow(size)
+	defer window.free()
+	for _, filename := range filenames {
+		window.AddFile(filename)
+		fmt.Fprintf(w, "%s: %s unique over last %d files\n", filename, formatCount(window.CurrentUnique()), len(window.files))
+	}
+	return window.CurrentUnique()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestRollingWindow(t *testing.T) {
+	first := writeInput(t, "1.txt", "10.0.0.1\n10.0.0.2\n11.0.0.1\n")
+	second := writeInput(t, "2.txt", "10.0.0.3\n12.0.0.1\n")
+	third := writeInput(t, "3.txt", "10.0.0.1\n")
+	block := writeInput(t, "block.txt", "11.0.0.1\n12.0.0.1\n12.0.0.2\n")
+
+	tests := []struct {
+		name  string
+		setup func()
+		size  int
+		want  uint64
+	}{
+		{"plain", func() {}, 2, 3},
+		{"evicted", func() {}, 1, 1},
+		{"block", func() { filter = newFilter("", block) }, 3, 3},
+		{"prefix", func() { config.Prefix = 10 }, 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t)
+			test.setup()
+			if got := runRollingWindow(io.Discard, test.size, []string{first, second, third}); got != test.want {
+				t.Errorf("got %d unique, want %d", got, test.want)
+			}
+			if filter != nil && filter.stats().Blocked != 2 {
+				t.Errorf("blocked %d, want 2", filter.stats().Blocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+// Builds the per-worker counter chain: filters -> key -> baseline -> heavy hitters -> progress or commit log -> backend.
+// Wrappers keep their own counters, done publishes them when worker finishes
+func workerCounter(counter Counter) (Counter, func()) {
+	var flushes []func()
+
+	if bitmap, ok := counter.(*Bitmap); ok && commitLog != nil {
+		c := newCommitLogCounter(bitmap, commitLog, COMMIT_LOG_BATCH)
+		counter = c
+		flushes = append(flushes, c.flush)
+	} else if ok && progress != nil {
+		c := &progressCounter{bitmap: bitmap, progress: progress, staged: config.stagesFiles()}
+		counter = c
+		flushes = append(flushes, c.flush)
+	} else if ok && smallInputTally != nil {
+		counter = &tallyCounter{bitmap: bitmap, tally: smallInputTally}
+	}
+
+	if heavyHitters != nil {
+		c := &heavyHittersCounter{inner: counter, hh: heavyHitters, batch: make([]uint32, 0, HEAVY_HITTERS_BATCH)}
+		counter = c
+		flushes = append(flushes, c.flush)
+	}
+
+	if savedBaseline != nil {
+		counter = &newVsSavedCounter{inner: counter, saved: savedBaseline}
+	}
+
+	// Allow/block lists hold addresses, everything behind them sees keys
+	if keyFn != nil {
+		counter = NewKeyCounter(counter, keyFn)
+	}
+
+	if filter != nil {
+		c := &filterCounter{inner: counter, filter: filter}
+		counter = c
+		flushes = append(flushes, c.flush)
+	}
+
+	return counter, func() {
+		for _, flush := range flushes {
+			flush()
+		}
+	}
+}
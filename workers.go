@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// Below this a chunk isn't worth a separate worker: goroutine start and
+// the final popcount over 512 MB cost more than parsing it
+const MIN_BYTES_PER_WORKER = 32 << 20
+
+// Worker count for the processing phase. Bitmap is shared and costs 512 MB no matter
+// how many workers write into it, so the only question is whether there's enough data:
+// one worker per 32 MB of input, at least 1 and at most one per CPU
+func RecommendWorkers(fileSize int64) int {
+	workers := int((fileSize + MIN_BYTES_PER_WORKER - 1) / MIN_BYTES_PER_WORKER)
+	return max(1, min(workers, runtime.NumCPU()))
+}
+
+// Per-file pool size for -parallel-files: CPUs are split between the files in flight,
+// so N files never run more than about one worker per CPU in total.
+// Files that can't be stat'ed (URLs) keep the default
+func RecommendFileWorkers(filenames []string, inFlight int) int {
+	total := int64(0)
+	for _, filename := range filenames {
+		fileInfo, err := os.Stat(filename)
+		if err != nil {
+			return WORKERS_AMOUNT
+		}
+		total += fileInfo.Size()
+	}
+
+	inFlight = max(1, min(inFlight, len(filenames)))
+	return max(1, min(RecommendWorkers(total/int64(inFlight)), runtime.NumCPU()/inFlight))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRecommendWorkers(t *testing.T) {
+	cpus := runtime.NumCPU()
+	tests := []struct {
+		size int64
+		want int // before the CPU cap
+	}{
+		{0, 1},
+		{1 << 10, 1},
+		{MIN_BYTES_PER_WORKER, 1},
+		{MIN_BYTES_PER_WORKER + 1, 2},
+		{100 << 20, 4},
+		{1 << 30, 32},
+		{120 << 30, 3840},
+	}
+
+	for _, test := range tests {
+		if got, want := RecommendWorkers(test.size), min(test.want, cpus); got != want {
+			t.Errorf("RecommendWorkers(%d) = %d, want %d", test.size, got, want)
+		}
+	}
+}
+
+func TestRecommendFileWorkers(t *testing.T) {
+	resetConfig(t)
+	dir := t.TempDir()
+	small := writeInput(t, "small.txt", "1.1.1.1\n")
+
+	// Sparse file: big by size, nothing on disk
+	big := filepath.Join(dir, "big.txt")
+	file, err := os.Create(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(4 << 30); err != nil {
+		t.Skip("no sparse files:", err)
+	}
+	file.Close()
+
+	cpus := runtime.NumCPU()
+	if got := RecommendFileWorkers([]string{small, small}, 2); got != 1 {
+		t.Errorf("two small files: %d workers, want 1", got)
+	}
+	// Plenty of data for every worker, so the CPUs are the limit, split between the files
+	for _, inFlight := range []int{1, 2, 4} {
+		if got, want := RecommendFileWorkers([]string{big, big, big, big}, inFlight), max(1, cpus/inFlight); got != want {
+			t.Errorf("%d files in flight: %d workers each, want %d", inFlight, got, want)
+		}
+	}
+
+	WORKERS_AMOUNT = 7
+	if got := RecommendFileWorkers([]string{"https://example.com/ips.txt"}, 1); got != 7 {
+		t.Errorf("URL: %d workers, want the default 7", got)
+	}
+}